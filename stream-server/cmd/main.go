@@ -3,27 +3,239 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"stream-server/internal/auth"
+	"stream-server/internal/config"
+	"stream-server/internal/directory"
 	"stream-server/internal/logger"
+	"stream-server/internal/metrics"
+	"stream-server/internal/rtc"
 	"stream-server/internal/server"
+	"stream-server/internal/storage"
 	"stream-server/internal/streaming"
+	"stream-server/internal/tracing"
+	ws "stream-server/internal/transport/websocket"
+	"stream-server/internal/turnserver"
+	"stream-server/internal/webhook"
+	"syscall"
 	"time"
+
+	"github.com/pion/webrtc/v4"
 )
 
+const tracingFlushTimeout = 5 * time.Second
+
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	runtime.SetMutexProfileFraction(cfg.Server.MutexProfileFraction)
+	log, ctx := logger.InitLogger(cfg.Log.Level, cfg.Log.Format, ctx)
+
+	shutdownTracing, err := tracing.Init(ctx, tracing.Config{
+		Endpoint:    cfg.Tracing.OTLPEndpoint,
+		Insecure:    cfg.Tracing.OTLPInsecure,
+		ServiceName: "stream-server",
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialise tracing")
+	}
+
+	rtcConfig := rtc.DefaultConfig()
+	rtcConfig.TrickleICE = cfg.RTC.TrickleICE
+	rtcConfig.GatheringTimeout = cfg.RTC.GatheringTimeout
+	rtcConfig.UDPPortMin = cfg.RTC.UDPPortMin
+	rtcConfig.UDPPortMax = cfg.RTC.UDPPortMax
+	rtcConfig.PublicIPs = cfg.RTC.PublicIPs
+	rtcConfig.ICEUDPPort = cfg.RTC.ICEUDPPort
+	rtcConfig.ICETCPPort = cfg.RTC.ICETCPPort
+	rtcConfig.ICEServers = nil
+	for _, server := range cfg.RTC.ICEServers {
+		rtcConfig.ICEServers = append(rtcConfig.ICEServers, webrtc.ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
+	}
+
+	settingEngine, err := rtc.NewSettingEngine(rtcConfig, log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to set up ICE transport")
+	}
+	rtcConfig.SettingEngine = settingEngine
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	runtime.SetMutexProfileFraction(1)
-	log, ctx := logger.InitLogger("debug", ctx)
+	var relay *turnserver.Server
+	if cfg.TURN.Enabled {
+		turnConfig := turnserver.DefaultConfig()
+		turnConfig.Port = cfg.TURN.Port
+		turnConfig.PublicIP = cfg.TURNPublicIP()
+		turnConfig.Realm = cfg.TURN.Realm
+		turnConfig.CredentialTTL = cfg.TURN.CredentialTTL
+		turnConfig.RelayPortMin = cfg.TURN.RelayPortMin
+		turnConfig.RelayPortMax = cfg.TURN.RelayPortMax
+		turnConfig.Secret = []byte(cfg.TURN.Secret)
+		if len(turnConfig.Secret) == 0 {
+			log.Warn().Msg("no TURN secret configured, generating an ephemeral one")
+			if turnConfig.Secret, err = auth.GenerateSecret(); err != nil {
+				log.Fatal().Err(err).Msg("failed to generate TURN secret")
+			}
+		}
+		if relay, err = turnserver.NewServer(log, turnConfig); err != nil {
+			log.Fatal().Err(err).Msg("failed to start TURN server")
+		}
+		rtcConfig.ICEServersFunc = func() []webrtc.ICEServer {
+			credentials := relay.Credentials("stream-server")
+			return []webrtc.ICEServer{{
+				URLs:       credentials.URLs,
+				Username:   credentials.Username,
+				Credential: credentials.Credential,
+			}}
+		}
+	}
 
-	rm := streaming.NewRoomManager(log)
-	serv := server.NewServer(log, rm)
+	roomPolicy := streaming.RoomPolicy{
+		EmptyTimeout:   &cfg.Room.EmptyTimeout,
+		MaxDuration:    cfg.Room.MaxDuration,
+		ClosingWarning: cfg.Room.ClosingWarning,
+		RoleCapacity:   cfg.Room.RoleCapacity,
+	}.Merge(streaming.DefaultRoomPolicy())
 
-	serv.SetupServer("8000")
-	serv.StartPprofServer("6060")
+	rm := streaming.NewRoomManager(log, rtcConfig, roomPolicy)
+
+	nodeID := cfg.Cluster.NodeID
+	if nodeID == "" {
+		if nodeID, err = os.Hostname(); err != nil {
+			log.Fatal().Err(err).Msg("failed to determine node id")
+		}
+	}
+	var roomDirectory directory.Directory = directory.NewMemory()
+	if cfg.Cluster.Directory == "redis" {
+		if roomDirectory, err = directory.DialRedis(ctx, cfg.Cluster.RedisURL, cfg.Cluster.KeyPrefix, cfg.Cluster.RoomTTL); err != nil {
+			log.Fatal().Err(err).Msg("failed to open room directory")
+		}
+	}
+	rm.SetDirectory(roomDirectory, streaming.Node{ID: nodeID, URL: cfg.Cluster.NodeURL})
+	if cfg.Cluster.Directory == "redis" {
+		rm.StartDirectoryHeartbeat(ctx, cfg.Cluster.RoomTTL/3)
+	}
+	log.Info().Str("node_id", nodeID).Str("directory", cfg.Cluster.Directory).Msg("room directory ready")
+
+	rm.StartReaper(ctx, cfg.Server.ReapInterval)
+	rm.StartStatsCollector(ctx, cfg.Server.StatsInterval)
+	metrics.Registry.MustRegister(rm.MetricsCollector())
+	secret := []byte(cfg.Auth.TokenSecret)
+	if len(secret) == 0 {
+		log.Warn().Msg("no token secret configured, generating an ephemeral one")
+		var err error
+		if secret, err = auth.GenerateSecret(); err != nil {
+			log.Fatal().Err(err).Msg("failed to generate token secret")
+		}
+	}
+	tokens := auth.NewTokenIssuer(secret, cfg.Auth.TokenTTL)
+	if cfg.Cluster.EdgeThreshold > 0 {
+		rm.EnableCascading(cfg.Cluster.EdgeThreshold, ws.NewRelayDialer(tokens, nodeID))
+		log.Info().Int("edge_threshold", cfg.Cluster.EdgeThreshold).Msg("room cascading enabled")
+	}
+
+	var apiKeys *auth.APIKeyStore
+	if cfg.Auth.APIKeysFile != "" {
+		var err error
+		if apiKeys, err = auth.LoadAPIKeyStore(cfg.Auth.APIKeysFile); err != nil {
+			log.Fatal().Err(err).Msg("failed to load API keys")
+		}
+		setTenantLimits(rm, apiKeys.Tenants())
+		log.Info().Int("tenants", len(apiKeys.Tenants())).Msg("API key authentication enabled")
+	} else {
+		log.Warn().Msg("no API key file configured, room management API is unauthenticated")
+	}
+
+	var webhooks *webhook.Dispatcher
+	// Tenants may add webhook URLs when the key file is reloaded, so the
+	// dispatcher also runs while there are none yet.
+	if endpoints := webhookEndpoints(cfg.Webhooks, apiKeys); len(endpoints) > 0 || apiKeys != nil {
+		webhookConfig := webhook.DefaultConfig()
+		webhookConfig.Endpoints = endpoints
+		webhooks = webhook.NewDispatcher(log, webhookConfig)
+		rm.Events().Subscribe("webhooks", webhooks.HandleEvent, streaming.SubscribeOptions{
+			Types: []streaming.EventType{
+				streaming.EventRoomStarted,
+				streaming.EventRoomFinished,
+				streaming.EventParticipantJoined,
+				streaming.EventParticipantLeft,
+				streaming.EventRoleChanged,
+				streaming.EventTrackPublished,
+				streaming.EventTrackUnpublished,
+				streaming.EventRecordingFinished,
+			},
+		})
+		log.Info().Int("endpoints", len(endpoints)).Msg("webhooks enabled")
+	}
+
+	if apiKeys != nil {
+		go apiKeys.Watch(ctx, func(tenants []auth.Tenant, err error) {
+			if err != nil {
+				log.Error().Err(err).Msg("failed to reload API keys, keeping the previous ones")
+				return
+			}
+			setTenantLimits(rm, tenants)
+			if webhooks != nil {
+				webhooks.SetEndpoints(webhookEndpoints(cfg.Webhooks, apiKeys))
+			}
+			log.Info().Int("tenants", len(tenants)).Msg("reloaded API keys")
+		})
+	}
+
+	var store storage.Store
+	if cfg.Storage.Path != "" {
+		if store, err = storage.OpenSQLite(cfg.Storage.Path); err != nil {
+			log.Fatal().Err(err).Msg("failed to open room storage")
+		}
+		recorder := storage.NewRecorder(log, store)
+		rm.SetPersister(recorder)
+		rm.Events().Subscribe("storage", recorder.HandleEvent, streaming.SubscribeOptions{
+			Types: []streaming.EventType{
+				streaming.EventParticipantJoined,
+				streaming.EventParticipantLeft,
+				streaming.EventRoleChanged,
+				streaming.EventTrackPublished,
+				streaming.EventTrackUnpublished,
+			},
+		})
+		log.Info().Str("path", cfg.Storage.Path).Msg("room storage enabled")
+	}
+
+	// Validated by config.Load.
+	trustedProxies, _ := cfg.Server.TrustedProxyPrefixes()
+
+	serv := server.NewServer(log, rm, tokens, apiKeys, webhooks, relay, store, server.Options{
+		AdminToken:        cfg.Auth.AdminToken,
+		AllowedOrigins:    cfg.CORS.AllowedOrigins,
+		TLSCertFile:       cfg.TLS.CertFile,
+		TLSKeyFile:        cfg.TLS.KeyFile,
+		TLSClientCAFile:   cfg.TLS.ClientCAFile,
+		TLSReloadInterval: cfg.TLS.ReloadInterval,
+		TrustedProxies:    trustedProxies,
+	})
+
+	if err := serv.SetupServer(ctx, cfg.Server.ListenAddr); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up the server")
+	}
+	if cfg.Server.PprofAddr != "" {
+		serv.StartPprofServer(cfg.Server.PprofAddr)
+	}
 
 	serv.RegisterRoutes()
 
@@ -35,15 +247,82 @@ func main() {
 
 	<-ctx.Done()
 
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	// ctx is already cancelled here, so the shutdown deadline starts fresh.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 
 	if err := serv.StopServer(ctx); err != nil {
 		log.Fatal().Err(err).Msg("server force to shutdown")
 	}
 
+	if store != nil {
+		if err := store.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close room storage")
+		}
+	}
+
+	if err := roomDirectory.Close(); err != nil {
+		log.Warn().Err(err).Msg("failed to close room directory")
+	}
+
+	if relay != nil {
+		if err := relay.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close TURN server")
+		}
+	}
+
+	if err := settingEngine.Close(); err != nil {
+		log.Warn().Err(err).Msg("failed to close ICE mux listeners")
+	}
+
+	// Flushing gets its own deadline so a slow shutdown above does not leave
+	// it with none.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Warn().Err(err).Msg("failed to flush traces")
+	}
+	cancelFlush()
+
 	stop()
 	cancel()
 
 	log.Info().Msg("server excited gracefully")
 
 }
+
+// setTenantLimits applies the quotas of the key file's tenants. Tenants that
+// were removed from the file lose their quotas.
+func setTenantLimits(rm *streaming.RoomManager, tenants []auth.Tenant) {
+	limits := make(map[string]streaming.TenantLimits, len(tenants))
+	for _, tenant := range tenants {
+		limits[tenant.ID] = streaming.TenantLimits{
+			MaxRooms:        tenant.MaxRooms,
+			MaxParticipants: tenant.MaxParticipants,
+		}
+	}
+	rm.ReplaceTenantLimits(limits)
+}
+
+// webhookEndpoints returns the configured webhook URLs for rooms created
+// without an API key and each tenant's own URLs.
+func webhookEndpoints(cfg config.WebhookConfig, apiKeys *auth.APIKeyStore) []webhook.Endpoint {
+	var endpoints []webhook.Endpoint
+	for _, url := range cfg.URLs {
+		endpoints = append(endpoints, webhook.Endpoint{
+			TenantID: streaming.DefaultTenantID,
+			URL:      url,
+			Secret:   []byte(cfg.Secret),
+		})
+	}
+	if apiKeys != nil {
+		for _, tenant := range apiKeys.Tenants() {
+			for _, url := range tenant.WebhookURLs {
+				endpoints = append(endpoints, webhook.Endpoint{
+					TenantID: tenant.ID,
+					URL:      url,
+					Secret:   []byte(tenant.WebhookSecret),
+				})
+			}
+		}
+	}
+	return endpoints
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+type Tenant struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	MaxRooms        int      `json:"maxRooms"`
+	MaxParticipants int      `json:"maxParticipants"`
+	APIKeys         []string `json:"apiKeys"`
+	// WebhookURLs receive the events of the tenant's rooms, signed with
+	// WebhookSecret.
+	WebhookURLs   []string `json:"webhookUrls"`
+	WebhookSecret string   `json:"webhookSecret"`
+}
+
+type apiKeyFile struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+// APIKeyStore maps API keys to tenants. Keys are indexed by their SHA-256
+// digest so lookups do not compare secrets directly.
+type APIKeyStore struct {
+	path    string
+	tenants []Tenant
+	keys    map[[sha256.Size]byte]Tenant
+	mu      sync.RWMutex
+}
+
+func LoadAPIKeyStore(path string) (*APIKeyStore, error) {
+	store := &APIKeyStore{path: path}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Reload re-reads the key file. The previous keys stay active if the file is
+// invalid.
+func (s *APIKeyStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read API key file %s: %w", s.path, err)
+	}
+
+	var file apiKeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse API key file %s: %w", s.path, err)
+	}
+
+	keys := make(map[[sha256.Size]byte]Tenant)
+	seen := make(map[string]bool)
+	for _, tenant := range file.Tenants {
+		if tenant.ID == "" {
+			return fmt.Errorf("tenant without id in %s", s.path)
+		}
+		if seen[tenant.ID] {
+			return fmt.Errorf("duplicate tenant id %q in %s", tenant.ID, s.path)
+		}
+		seen[tenant.ID] = true
+
+		if len(tenant.WebhookURLs) > 0 && tenant.WebhookSecret == "" {
+			return fmt.Errorf("tenant %q has webhook URLs but no webhook secret", tenant.ID)
+		}
+		for _, url := range tenant.WebhookURLs {
+			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+				return fmt.Errorf("webhook URL %q of tenant %q must be an http or https URL", url, tenant.ID)
+			}
+		}
+
+		for _, key := range tenant.APIKeys {
+			if key == "" {
+				return fmt.Errorf("empty API key for tenant %q", tenant.ID)
+			}
+			digest := sha256.Sum256([]byte(key))
+			if _, exists := keys[digest]; exists {
+				return fmt.Errorf("API key reused across tenants (tenant %q)", tenant.ID)
+			}
+			keys[digest] = tenant
+		}
+	}
+
+	s.mu.Lock()
+	s.tenants = file.Tenants
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the key file on SIGHUP until ctx is done and reports each
+// reload to onReload, with the new tenants or the error that kept the old ones.
+func (s *APIKeyStore) Watch(ctx context.Context, onReload func(tenants []Tenant, err error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := s.Reload(); err != nil {
+				onReload(nil, err)
+				continue
+			}
+			onReload(s.Tenants(), nil)
+		}
+	}
+}
+
+func (s *APIKeyStore) Lookup(key string) (Tenant, bool) {
+	if key == "" {
+		return Tenant{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tenant, ok := s.keys[sha256.Sum256([]byte(key))]
+	return tenant, ok
+}
+
+func (s *APIKeyStore) Tenants() []Tenant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Tenant(nil), s.tenants...)
+}
+
+const tenantKey contextKey = "tenant"
+
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenantID)
+}
+
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantKey).(string)
+	return tenantID, ok
+}
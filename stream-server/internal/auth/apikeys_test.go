@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKeyFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPIKeyLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeyFile(t, path, `{"tenants":[
+		{"id":"acme","maxRooms":3,"apiKeys":["acme-key","acme-key-2"]},
+		{"id":"globex","apiKeys":["globex-key"]}
+	]}`)
+	store, err := LoadAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyStore: %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		tenant string
+	}{
+		{"acme-key", "acme"},
+		{"acme-key-2", "acme"},
+		{"globex-key", "globex"},
+		{"unknown", ""},
+		{"ACME-KEY", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		tenant, ok := store.Lookup(tt.key)
+		if ok != (tt.tenant != "") || tenant.ID != tt.tenant {
+			t.Errorf("Lookup(%q) = %q, %v, want %q", tt.key, tenant.ID, ok, tt.tenant)
+		}
+	}
+
+	if tenant, _ := store.Lookup("acme-key"); tenant.MaxRooms != 3 {
+		t.Errorf("acme max rooms = %d, want 3", tenant.MaxRooms)
+	}
+	if tenants := store.Tenants(); len(tenants) != 2 {
+		t.Errorf("Tenants() returned %d tenants, want 2", len(tenants))
+	}
+}
+
+func TestAPIKeyReload(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"not json", `{"tenants":`, "failed to parse"},
+		{"missing id", `{"tenants":[{"apiKeys":["k"]}]}`, "tenant without id"},
+		{"duplicate id", `{"tenants":[{"id":"a","apiKeys":["k1"]},{"id":"a","apiKeys":["k2"]}]}`, "duplicate tenant id"},
+		{"empty key", `{"tenants":[{"id":"a","apiKeys":[""]}]}`, "empty API key"},
+		{"reused key", `{"tenants":[{"id":"a","apiKeys":["k"]},{"id":"b","apiKeys":["k"]}]}`, "reused across tenants"},
+		{"webhook without secret", `{"tenants":[{"id":"a","apiKeys":["k"],"webhookUrls":["https://example.com"]}]}`, "no webhook secret"},
+		{"webhook not http", `{"tenants":[{"id":"a","apiKeys":["k"],"webhookUrls":["ftp://example.com"],"webhookSecret":"s"}]}`, "http or https"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			writeKeyFile(t, path, `{"tenants":[{"id":"acme","apiKeys":["acme-key"]}]}`)
+			store, err := LoadAPIKeyStore(path)
+			if err != nil {
+				t.Fatalf("LoadAPIKeyStore: %v", err)
+			}
+
+			writeKeyFile(t, path, tt.file)
+			err = store.Reload()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Reload = %v, want an error containing %q", err, tt.wantErr)
+			}
+			if tenant, ok := store.Lookup("acme-key"); !ok || tenant.ID != "acme" {
+				t.Error("failed reload dropped the previous keys")
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keys.json")
+		writeKeyFile(t, path, `{"tenants":[{"id":"acme","apiKeys":["acme-key"]}]}`)
+		store, err := LoadAPIKeyStore(path)
+		if err != nil {
+			t.Fatalf("LoadAPIKeyStore: %v", err)
+		}
+
+		writeKeyFile(t, path, `{"tenants":[{"id":"acme","apiKeys":["rotated-key"]},{"id":"globex","apiKeys":["globex-key"]}]}`)
+		if err := store.Reload(); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+		if _, ok := store.Lookup("acme-key"); ok {
+			t.Error("rotated key still accepted")
+		}
+		if tenant, ok := store.Lookup("rotated-key"); !ok || tenant.ID != "acme" {
+			t.Errorf("Lookup(rotated-key) = %q, %v", tenant.ID, ok)
+		}
+		if tenant, ok := store.Lookup("globex-key"); !ok || tenant.ID != "globex" {
+			t.Errorf("Lookup(globex-key) = %q, %v", tenant.ID, ok)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := LoadAPIKeyStore(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Error("LoadAPIKeyStore accepted a missing file")
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"stream-server/internal/core"
+)
+
+func TestVerify(t *testing.T) {
+	issuer := NewTokenIssuer([]byte("secret"), time.Minute)
+	permissions := core.RoleTemplates[core.RoleGuest]
+
+	valid, _, err := issuer.Issue("room-1", "acme", "alice", core.RoleGuest, permissions)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	expired, _, _ := NewTokenIssuer([]byte("secret"), -time.Second).Issue("room-1", "acme", "alice", core.RoleGuest, permissions)
+	otherSecret, _, _ := NewTokenIssuer([]byte("other"), time.Minute).Issue("room-1", "acme", "alice", core.RoleGuest, permissions)
+	expiredOtherSecret, _, _ := NewTokenIssuer([]byte("other"), -time.Second).Issue("room-1", "acme", "alice", core.RoleGuest, permissions)
+	host, _, _ := issuer.Issue("room-1", "acme", "alice", core.RoleHost, core.RoleTemplates[core.RoleHost])
+
+	parts := strings.Split(valid, ".")
+	hostParts := strings.Split(host, ".")
+	header := func(alg string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + alg + `","typ":"JWT"}`))
+	}
+	// Signed with the issuer's own key, so only the header gives these away.
+	resigned := func(alg string) string {
+		signingInput := header(alg) + "." + parts[1]
+		return signingInput + "." + issuer.sign(signingInput)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid", valid, nil},
+		{"expired", expired, ErrTokenExpired},
+		{"signed with another secret", otherSecret, ErrInvalidToken},
+		{"expired and signed with another secret", expiredOtherSecret, ErrInvalidToken},
+		{"truncated signature", valid[:len(valid)-2], ErrInvalidToken},
+		{"payload swapped", parts[0] + "." + hostParts[1] + "." + parts[2], ErrInvalidToken},
+		{"alg none", header("none") + "." + parts[1] + ".", ErrInvalidToken},
+		{"alg none with signature", header("none") + "." + parts[1] + "." + parts[2], ErrInvalidToken},
+		{"alg HS512", resigned("HS512"), ErrInvalidToken},
+		{"alg RS256", resigned("RS256"), ErrInvalidToken},
+		{"two parts", parts[0] + "." + parts[1], ErrInvalidToken},
+		{"empty", "", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := issuer.Verify(tt.token)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+			if tt.want != nil {
+				return
+			}
+			if claims.RoomID != "room-1" || claims.TenantID != "acme" || claims.UserID != "alice" || claims.Role != core.RoleGuest {
+				t.Errorf("claims = %+v", claims)
+			}
+			if claims.Permissions != permissions {
+				t.Errorf("permissions = %+v, want %+v", claims.Permissions, permissions)
+			}
+		})
+	}
+}
+
+func TestIssueSetsExpiry(t *testing.T) {
+	issuer := NewTokenIssuer([]byte("secret"), time.Hour)
+	_, claims, err := issuer.Issue("room-1", "acme", "alice", core.RoleGuest, core.Permissions{})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if got := claims.ExpiresAt - claims.IssuedAt; got != int64(time.Hour/time.Second) {
+		t.Errorf("token lifetime = %ds, want %ds", got, int64(time.Hour/time.Second))
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"Bearer abc", "abc"},
+		{"bearer abc ", "abc"},
+		{"Bearer ", ""},
+		{"Basic abc", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := BearerToken(tt.header); got != tt.want {
+			t.Errorf("BearerToken(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"stream-server/internal/core"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete server configuration. Values are applied in order:
+// defaults, the config file, STREAM_* environment variables, then flags that
+// were set explicitly on the command line.
+type Config struct {
+	Server   ServerConfig  `yaml:"server" toml:"server"`
+	TLS      TLSConfig     `yaml:"tls" toml:"tls"`
+	Log      LogConfig     `yaml:"log" toml:"log"`
+	CORS     CORSConfig    `yaml:"cors" toml:"cors"`
+	RTC      RTCConfig     `yaml:"rtc" toml:"rtc"`
+	Room     RoomConfig    `yaml:"room" toml:"room"`
+	Auth     AuthConfig    `yaml:"auth" toml:"auth"`
+	Webhooks WebhookConfig `yaml:"webhooks" toml:"webhooks"`
+	Tracing  TracingConfig `yaml:"tracing" toml:"tracing"`
+	TURN     TURNConfig    `yaml:"turn" toml:"turn"`
+	Cluster  ClusterConfig `yaml:"cluster" toml:"cluster"`
+	Storage  StorageConfig `yaml:"storage" toml:"storage"`
+}
+
+type ServerConfig struct {
+	ListenAddr string `yaml:"listen_addr" toml:"listen_addr"`
+	// PprofAddr serves net/http/pprof; leave empty to disable it.
+	PprofAddr            string        `yaml:"pprof_addr" toml:"pprof_addr"`
+	MutexProfileFraction int           `yaml:"mutex_profile_fraction" toml:"mutex_profile_fraction"`
+	ShutdownTimeout      time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	ReapInterval         time.Duration `yaml:"reap_interval" toml:"reap_interval"`
+	StatsInterval        time.Duration `yaml:"stats_interval" toml:"stats_interval"`
+	// TrustedProxies are the IPs or CIDRs whose X-Forwarded-Proto header is
+	// honoured.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+	// ClientCAFile enables mTLS for admin routes.
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file"`
+	// ReloadInterval is how often the files are checked for changes. SIGHUP
+	// reloads them immediately.
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+type LogConfig struct {
+	Level string `yaml:"level" toml:"level"`
+	// Format is "console" for human-readable output or "json".
+	Format string `yaml:"format" toml:"format"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+}
+
+type ICEServer struct {
+	URLs       []string `yaml:"urls" toml:"urls"`
+	Username   string   `yaml:"username" toml:"username"`
+	Credential string   `yaml:"credential" toml:"credential"`
+}
+
+type RTCConfig struct {
+	ICEServers []ICEServer `yaml:"ice_servers" toml:"ice_servers"`
+	UDPPortMin uint16      `yaml:"udp_port_min" toml:"udp_port_min"`
+	UDPPortMax uint16      `yaml:"udp_port_max" toml:"udp_port_max"`
+	PublicIPs  []string    `yaml:"public_ips" toml:"public_ips"`
+	// ICEUDPPort and ICETCPPort multiplex ICE for all peer connections on one
+	// port each; zero disables the mux.
+	ICEUDPPort       int           `yaml:"ice_udp_port" toml:"ice_udp_port"`
+	ICETCPPort       int           `yaml:"ice_tcp_port" toml:"ice_tcp_port"`
+	TrickleICE       bool          `yaml:"trickle_ice" toml:"trickle_ice"`
+	GatheringTimeout time.Duration `yaml:"gathering_timeout" toml:"gathering_timeout"`
+}
+
+type RoomConfig struct {
+	// EmptyTimeout of zero keeps empty rooms open.
+	EmptyTimeout   time.Duration  `yaml:"empty_timeout" toml:"empty_timeout"`
+	MaxDuration    time.Duration  `yaml:"max_duration" toml:"max_duration"`
+	ClosingWarning time.Duration  `yaml:"closing_warning" toml:"closing_warning"`
+	RoleCapacity   map[string]int `yaml:"role_capacity" toml:"role_capacity"`
+}
+
+type AuthConfig struct {
+	TokenSecret string        `yaml:"token_secret" toml:"token_secret"`
+	TokenTTL    time.Duration `yaml:"token_ttl" toml:"token_ttl"`
+	APIKeysFile string        `yaml:"api_keys_file" toml:"api_keys_file"`
+	AdminToken  string        `yaml:"admin_token" toml:"admin_token"`
+}
+
+type WebhookConfig struct {
+	URLs   []string `yaml:"urls" toml:"urls"`
+	Secret string   `yaml:"secret" toml:"secret"`
+}
+
+type TracingConfig struct {
+	OTLPEndpoint string  `yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	OTLPInsecure bool    `yaml:"otlp_insecure" toml:"otlp_insecure"`
+	SampleRatio  float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+type TURNConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	Port    int  `yaml:"port" toml:"port"`
+	// PublicIP defaults to the first rtc.public_ips entry.
+	PublicIP string `yaml:"public_ip" toml:"public_ip"`
+	Realm    string `yaml:"realm" toml:"realm"`
+	// Secret signs relay credentials; an ephemeral one is generated when
+	// empty.
+	Secret        string        `yaml:"secret" toml:"secret"`
+	CredentialTTL time.Duration `yaml:"credential_ttl" toml:"credential_ttl"`
+	RelayPortMin  uint16        `yaml:"relay_port_min" toml:"relay_port_min"`
+	RelayPortMax  uint16        `yaml:"relay_port_max" toml:"relay_port_max"`
+}
+
+type ClusterConfig struct {
+	// Directory is "memory" for a single node or "redis" to share rooms
+	// between nodes.
+	Directory string `yaml:"directory" toml:"directory"`
+	RedisURL  string `yaml:"redis_url" toml:"redis_url"`
+	// KeyPrefix namespaces directory keys in Redis.
+	KeyPrefix string `yaml:"key_prefix" toml:"key_prefix"`
+	// NodeID defaults to the host name.
+	NodeID string `yaml:"node_id" toml:"node_id"`
+	// NodeURL is this node's public base URL; other nodes redirect room
+	// requests to it and join responses point WebSocket clients at it.
+	NodeURL string `yaml:"node_url" toml:"node_url"`
+	// RoomTTL is how long a room stays in the directory after its node stops
+	// refreshing it.
+	RoomTTL time.Duration `yaml:"room_ttl" toml:"room_ttl"`
+	// EdgeThreshold is how many participants a room holds on its owning node
+	// before new joiners are sent to the least loaded other node, which relays
+	// the room's tracks from the owner. Zero disables cascading.
+	EdgeThreshold int `yaml:"edge_threshold" toml:"edge_threshold"`
+}
+
+type StorageConfig struct {
+	// Path is the SQLite database that rooms and their history are persisted
+	// to. Leave empty to keep rooms in memory only.
+	Path string `yaml:"path" toml:"path"`
+}
+
+// TURNPublicIP returns the address the TURN server advertises.
+func (c Config) TURNPublicIP() string {
+	if c.TURN.PublicIP == "" && len(c.RTC.PublicIPs) > 0 {
+		return c.RTC.PublicIPs[0]
+	}
+	return c.TURN.PublicIP
+}
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			ListenAddr:           ":8000",
+			PprofAddr:            "localhost:6060",
+			MutexProfileFraction: 1,
+			ShutdownTimeout:      30 * time.Second,
+			ReapInterval:         10 * time.Second,
+			StatsInterval:        5 * time.Second,
+		},
+		TLS: TLSConfig{
+			ReloadInterval: time.Minute,
+		},
+		Log: LogConfig{
+			Level:  "debug",
+			Format: "console",
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+		},
+		RTC: RTCConfig{
+			ICEServers: []ICEServer{
+				{URLs: []string{"stun:stun.l.google.com:19302"}},
+			},
+			GatheringTimeout: 5 * time.Second,
+		},
+		Room: RoomConfig{
+			EmptyTimeout:   5 * time.Minute,
+			ClosingWarning: time.Minute,
+			RoleCapacity: map[string]int{
+				core.RoleHost:  1,
+				core.RoleGuest: 1,
+			},
+		},
+		Auth: AuthConfig{
+			TokenTTL: 2 * time.Minute,
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
+		TURN: TURNConfig{
+			Port:          3478,
+			Realm:         "stream-server",
+			CredentialTTL: time.Hour,
+		},
+		Cluster: ClusterConfig{
+			Directory: "memory",
+			KeyPrefix: "stream:",
+			RoomTTL:   30 * time.Second,
+		},
+	}
+}
+
+// TrustedProxyPrefixes parses TrustedProxies; a bare IP is a single-address
+// prefix.
+func (c ServerConfig) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Load builds the configuration from the command line arguments (without the
+// program name). The config file is taken from -config or STREAM_CONFIG.
+func Load(args []string) (Config, error) {
+	// The first pass only finds the config file; flags are parsed again after
+	// the file and environment so that they take precedence.
+	scratch := Default()
+	fs := newFlagSet(&scratch)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	path := fs.Lookup("config").Value.String()
+
+	cfg := Default()
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return Config{}, err
+	}
+	if err := newFlagSet(&cfg).Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown key %q in config file %s", undecoded[0].String(), path)
+		}
+	default:
+		return fmt.Errorf("config file %s must have a .yaml, .yml or .toml extension", path)
+	}
+	return nil
+}
+
+func newFlagSet(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("stream-server", flag.ContinueOnError)
+
+	fs.String("config", os.Getenv("STREAM_CONFIG"), "YAML or TOML config file")
+	fs.StringVar(&cfg.Server.ListenAddr, "listen-addr", cfg.Server.ListenAddr, "address the HTTP server listens on")
+	fs.StringVar(&cfg.Server.PprofAddr, "pprof-addr", cfg.Server.PprofAddr, "address of the pprof server; leave empty to disable it")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", cfg.Server.ShutdownTimeout, "how long shutdown waits for a drain to finish before closing rooms")
+	fs.DurationVar(&cfg.Server.StatsInterval, "stats-interval", cfg.Server.StatsInterval, "how often peer connection stats are collected")
+	fs.StringVar(&cfg.TLS.CertFile, "tls-cert", cfg.TLS.CertFile, "TLS certificate file; serves HTTPS when set")
+	fs.StringVar(&cfg.TLS.KeyFile, "tls-key", cfg.TLS.KeyFile, "TLS private key file")
+	fs.StringVar(&cfg.TLS.ClientCAFile, "tls-client-ca", cfg.TLS.ClientCAFile, "CA bundle for client certificates; admin routes then require one")
+	fs.Var((*listValue)(&cfg.Server.TrustedProxies), "trusted-proxies", "comma-separated IPs or CIDRs allowed to set X-Forwarded-Proto")
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "log level: trace, debug, info, warn or error")
+	fs.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, "log format: console or json")
+	fs.Var((*listValue)(&cfg.CORS.AllowedOrigins), "cors-origins", "comma-separated origins allowed by CORS")
+	fs.Var((*listValue)(&cfg.RTC.PublicIPs), "public-ips", "comma-separated public IPs announced in ICE host candidates")
+	fs.Var((*portRangeValue)(&cfg.RTC), "udp-port-range", "UDP port range for ICE as min-max")
+	fs.IntVar(&cfg.RTC.ICEUDPPort, "ice-udp-port", cfg.RTC.ICEUDPPort, "single UDP port shared by all peer connections; 0 uses ephemeral ports")
+	fs.IntVar(&cfg.RTC.ICETCPPort, "ice-tcp-port", cfg.RTC.ICETCPPort, "TCP port for ICE-TCP candidates; 0 disables ICE-TCP")
+	fs.BoolVar(&cfg.RTC.TrickleICE, "trickle-ice", cfg.RTC.TrickleICE, "answer SDP offers immediately and trickle ICE candidates")
+	fs.StringVar(&cfg.Auth.TokenSecret, "token-secret", cfg.Auth.TokenSecret, "HMAC secret used to sign join tokens")
+	fs.DurationVar(&cfg.Auth.TokenTTL, "token-ttl", cfg.Auth.TokenTTL, "lifetime of issued join tokens")
+	fs.StringVar(&cfg.Auth.APIKeysFile, "api-keys-file", cfg.Auth.APIKeysFile, "JSON file mapping API keys to tenants; leave empty to disable API key checks")
+	fs.StringVar(&cfg.Auth.AdminToken, "admin-token", cfg.Auth.AdminToken, "bearer token for admin routes such as /drain; leave empty to disable them")
+	fs.Var((*listValue)(&cfg.Webhooks.URLs), "webhook-urls", "comma-separated endpoints that receive events of rooms created without an API key")
+	fs.StringVar(&cfg.Webhooks.Secret, "webhook-secret", cfg.Webhooks.Secret, "HMAC secret used to sign webhook payloads")
+	fs.StringVar(&cfg.Tracing.OTLPEndpoint, "otlp-endpoint", cfg.Tracing.OTLPEndpoint, "OTLP/HTTP collector host:port for traces; leave empty to disable export")
+	fs.BoolVar(&cfg.Tracing.OTLPInsecure, "otlp-insecure", cfg.Tracing.OTLPInsecure, "send traces to the OTLP collector over plain HTTP")
+	fs.BoolVar(&cfg.TURN.Enabled, "turn", cfg.TURN.Enabled, "run the embedded TURN server")
+	fs.IntVar(&cfg.TURN.Port, "turn-port", cfg.TURN.Port, "UDP and TCP port of the embedded TURN server")
+	fs.StringVar(&cfg.TURN.PublicIP, "turn-public-ip", cfg.TURN.PublicIP, "public IP advertised by the TURN server; defaults to the first public IP")
+	fs.StringVar(&cfg.TURN.Secret, "turn-secret", cfg.TURN.Secret, "HMAC secret for TURN credentials")
+	fs.StringVar(&cfg.Cluster.Directory, "directory", cfg.Cluster.Directory, "room directory backend: memory or redis")
+	fs.StringVar(&cfg.Cluster.RedisURL, "redis-url", cfg.Cluster.RedisURL, "redis URL for the shared room directory")
+	fs.StringVar(&cfg.Cluster.NodeID, "node-id", cfg.Cluster.NodeID, "unique name of this node; defaults to the host name")
+	fs.StringVar(&cfg.Cluster.NodeURL, "node-url", cfg.Cluster.NodeURL, "public base URL of this node, e.g. https://node-1.example.com")
+	fs.IntVar(&cfg.Cluster.EdgeThreshold, "edge-threshold", cfg.Cluster.EdgeThreshold, "participants a room holds on its node before joiners are relayed from another node; 0 disables")
+	fs.StringVar(&cfg.Storage.Path, "storage-path", cfg.Storage.Path, "SQLite database rooms are persisted to; leave empty to disable persistence")
+	fs.Float64Var(&cfg.Tracing.SampleRatio, "trace-sample-ratio", cfg.Tracing.SampleRatio, "fraction of new traces to sample")
+
+	return fs
+}
+
+// Validate reports every invalid setting at once, each prefixed with its
+// config file key.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(key string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.ListenAddr); err != nil {
+		invalid("server.listen_addr", "%v", err)
+	}
+	if c.Server.PprofAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Server.PprofAddr); err != nil {
+			invalid("server.pprof_addr", "%v", err)
+		}
+	}
+	if c.Server.MutexProfileFraction < 0 {
+		invalid("server.mutex_profile_fraction", "must not be negative")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		invalid("server.shutdown_timeout", "must be positive")
+	}
+	if c.Server.ReapInterval <= 0 {
+		invalid("server.reap_interval", "must be positive")
+	}
+	if c.Server.StatsInterval <= 0 {
+		invalid("server.stats_interval", "must be positive")
+	}
+	if _, err := c.Server.TrustedProxyPrefixes(); err != nil {
+		invalid("server.trusted_proxies", "%v", err)
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		invalid("tls", "cert_file and key_file must be set together")
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled() {
+		invalid("tls.client_ca_file", "requires cert_file and key_file")
+	}
+	if c.TLS.Enabled() && c.TLS.ReloadInterval <= 0 {
+		invalid("tls.reload_interval", "must be positive")
+	}
+	for key, path := range map[string]string{"tls.cert_file": c.TLS.CertFile, "tls.key_file": c.TLS.KeyFile, "tls.client_ca_file": c.TLS.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			invalid(key, "%v", err)
+		}
+	}
+
+	if _, err := zerolog.ParseLevel(c.Log.Level); err != nil || c.Log.Level == "" {
+		invalid("log.level", "unknown level %q", c.Log.Level)
+	}
+	if c.Log.Format != "console" && c.Log.Format != "json" {
+		invalid("log.format", "must be console or json, got %q", c.Log.Format)
+	}
+
+	if len(c.CORS.AllowedOrigins) == 0 {
+		invalid("cors.allowed_origins", "must list at least one origin")
+	}
+
+	for i, server := range c.RTC.ICEServers {
+		key := fmt.Sprintf("rtc.ice_servers[%d]", i)
+		if len(server.URLs) == 0 {
+			invalid(key, "urls must not be empty")
+		}
+		for _, url := range server.URLs {
+			switch {
+			case strings.HasPrefix(url, "stun:"), strings.HasPrefix(url, "stuns:"):
+			case strings.HasPrefix(url, "turn:"), strings.HasPrefix(url, "turns:"):
+				if server.Username == "" || server.Credential == "" {
+					invalid(key, "TURN server %s needs a username and credential", url)
+				}
+			default:
+				invalid(key, "URL %q must start with stun:, stuns:, turn: or turns:", url)
+			}
+		}
+	}
+	if (c.RTC.UDPPortMin == 0) != (c.RTC.UDPPortMax == 0) {
+		invalid("rtc", "udp_port_min and udp_port_max must be set together")
+	} else if c.RTC.UDPPortMin > c.RTC.UDPPortMax {
+		invalid("rtc", "udp_port_min %d is above udp_port_max %d", c.RTC.UDPPortMin, c.RTC.UDPPortMax)
+	}
+	for _, ip := range c.RTC.PublicIPs {
+		if net.ParseIP(ip) == nil {
+			invalid("rtc.public_ips", "%q is not an IP address", ip)
+		}
+	}
+	for key, port := range map[string]int{"rtc.ice_udp_port": c.RTC.ICEUDPPort, "rtc.ice_tcp_port": c.RTC.ICETCPPort} {
+		if port < 0 || port > 65535 {
+			invalid(key, "%d is not a valid port", port)
+		}
+	}
+	if c.RTC.GatheringTimeout <= 0 {
+		invalid("rtc.gathering_timeout", "must be positive")
+	}
+
+	if c.Room.EmptyTimeout < 0 || c.Room.MaxDuration < 0 || c.Room.ClosingWarning < 0 {
+		invalid("room", "durations must not be negative")
+	}
+	for role, capacity := range c.Room.RoleCapacity {
+		if !core.IsValidRole(role) {
+			invalid("room.role_capacity", "unknown role %q", role)
+		} else if capacity < 0 {
+			invalid("room.role_capacity", "capacity for %q must not be negative", role)
+		}
+	}
+
+	if c.Auth.TokenTTL <= 0 {
+		invalid("auth.token_ttl", "must be positive")
+	}
+
+	if len(c.Webhooks.URLs) > 0 && c.Webhooks.Secret == "" {
+		invalid("webhooks.secret", "required when webhook URLs are configured")
+	}
+	for _, url := range c.Webhooks.URLs {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			invalid("webhooks.urls", "%q must be an http or https URL", url)
+		}
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid("tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	switch c.Cluster.Directory {
+	case "memory":
+	case "redis":
+		if c.Cluster.RedisURL == "" {
+			invalid("cluster.redis_url", "required for the redis directory")
+		}
+		if c.Cluster.NodeURL == "" {
+			invalid("cluster.node_url", "required for the redis directory")
+		}
+		if c.Auth.TokenSecret == "" {
+			invalid("auth.token_secret", "must be set and shared by all nodes when using the redis directory")
+		}
+		if c.Cluster.RoomTTL < 3*time.Second {
+			invalid("cluster.room_ttl", "must be at least 3s")
+		}
+	default:
+		invalid("cluster.directory", "must be memory or redis, got %q", c.Cluster.Directory)
+	}
+	if c.Cluster.EdgeThreshold < 0 {
+		invalid("cluster.edge_threshold", "must not be negative")
+	}
+	if c.Cluster.EdgeThreshold > 0 && c.Cluster.Directory != "redis" {
+		invalid("cluster.edge_threshold", "requires the redis directory")
+	}
+	if c.Cluster.NodeURL != "" && !strings.HasPrefix(c.Cluster.NodeURL, "http://") && !strings.HasPrefix(c.Cluster.NodeURL, "https://") {
+		invalid("cluster.node_url", "%q must be an http or https URL", c.Cluster.NodeURL)
+	}
+
+	if c.TURN.Enabled {
+		if c.TURN.Port <= 0 || c.TURN.Port > 65535 {
+			invalid("turn.port", "%d is not a valid port", c.TURN.Port)
+		}
+		if ip := c.TURNPublicIP(); ip == "" {
+			invalid("turn.public_ip", "required when rtc.public_ips is empty")
+		} else if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() == nil {
+			invalid("turn.public_ip", "%q is not an IPv4 address", ip)
+		}
+		if c.TURN.CredentialTTL <= 0 {
+			invalid("turn.credential_ttl", "must be positive")
+		}
+		if (c.TURN.RelayPortMin == 0) != (c.TURN.RelayPortMax == 0) {
+			invalid("turn", "relay_port_min and relay_port_max must be set together")
+		} else if c.TURN.RelayPortMin > c.TURN.RelayPortMax {
+			invalid("turn", "relay_port_min %d is above relay_port_max %d", c.TURN.RelayPortMin, c.TURN.RelayPortMax)
+		}
+	}
+
+	return errors.Join(errs...)
+}
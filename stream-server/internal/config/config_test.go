@@ -0,0 +1,162 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name string, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+server:
+  listen_addr: ":9000"
+  shutdown_timeout: 10s
+log:
+  level: info
+  format: json
+auth:
+  token_ttl: 1m
+`,
+		"config.toml": `
+[server]
+listen_addr = ":9000"
+shutdown_timeout = "10s"
+
+[log]
+level = "info"
+format = "json"
+
+[auth]
+token_ttl = "1m"
+`,
+	}
+	for name, contents := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfig(t, name, contents)
+			t.Setenv("STREAM_LOG_LEVEL", "warn")
+			t.Setenv("STREAM_TOKEN_TTL", "5m")
+
+			cfg, err := Load([]string{"-config", path, "-token-ttl", "7m"})
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			tests := []struct {
+				setting string
+				got     any
+				want    any
+			}{
+				{"default", cfg.Server.StatsInterval, 5 * time.Second},
+				{"file", cfg.Server.ListenAddr, ":9000"},
+				{"file", cfg.Server.ShutdownTimeout, 10 * time.Second},
+				{"file", cfg.Log.Format, "json"},
+				{"environment over file", cfg.Log.Level, "warn"},
+				{"flag over environment and file", cfg.Auth.TokenTTL, 7 * time.Minute},
+			}
+			for _, tt := range tests {
+				if tt.got != tt.want {
+					t.Errorf("%s: got %v, want %v", tt.setting, tt.got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromEnvironment(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "log:\n  level: error\n")
+	t.Setenv("STREAM_CONFIG", path)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Log.Level != "error" {
+		t.Errorf("log level = %q, want the file's error", cfg.Log.Level)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+	}{
+		{"yaml key", "config.yaml", "server:\n  listen_adr: \":9000\"\n"},
+		{"yaml section", "config.yaml", "sever:\n  listen_addr: \":9000\"\n"},
+		{"toml key", "config.toml", "[server]\nlisten_adr = \":9000\"\n"},
+		{"toml section", "config.toml", "[sever]\nlisten_addr = \":9000\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.file, tt.contents)
+			_, err := Load([]string{"-config", path})
+			if err == nil {
+				t.Fatal("Load accepted a misspelt key")
+			}
+			if !strings.Contains(err.Error(), path) {
+				t.Errorf("error %q does not name the config file", err)
+			}
+		})
+	}
+
+	path := writeConfig(t, "config.json", "{}")
+	if _, err := Load([]string{"-config", path}); err == nil {
+		t.Error("Load accepted a config file with an unsupported extension")
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+server:
+  listen_addr: "no-port"
+log:
+  format: xml
+rtc:
+  public_ips: ["not-an-ip"]
+webhooks:
+  urls: ["https://example.com/hook"]
+cluster:
+  directory: etcd
+`)
+	t.Setenv("STREAM_TOKEN_TTL", "0s")
+
+	_, err := Load([]string{"-config", path, "-trace-sample-ratio", "2"})
+	if err == nil {
+		t.Fatal("Load accepted an invalid config")
+	}
+
+	for _, key := range []string{
+		"server.listen_addr",
+		"log.format",
+		"rtc.public_ips",
+		"webhooks.secret",
+		"cluster.directory",
+		"auth.token_ttl",
+		"tracing.sample_ratio",
+	} {
+		if !strings.Contains(err.Error(), key+":") {
+			t.Errorf("error does not mention %s:\n%v", key, err)
+		}
+	}
+	if lines := strings.Count(err.Error(), "\n") + 1; lines != 7 {
+		t.Errorf("got %d errors, want 7:\n%v", lines, err)
+	}
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Errorf("Default().Validate() = %v", err)
+	}
+}
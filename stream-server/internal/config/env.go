@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv overrides cfg with the STREAM_* variables that are set.
+func applyEnv(cfg *Config) error {
+	stringVars := map[string]*string{
+		"STREAM_LISTEN_ADDR":    &cfg.Server.ListenAddr,
+		"STREAM_PPROF_ADDR":     &cfg.Server.PprofAddr,
+		"STREAM_TLS_CERT":       &cfg.TLS.CertFile,
+		"STREAM_TLS_KEY":        &cfg.TLS.KeyFile,
+		"STREAM_TLS_CLIENT_CA":  &cfg.TLS.ClientCAFile,
+		"STREAM_LOG_LEVEL":      &cfg.Log.Level,
+		"STREAM_LOG_FORMAT":     &cfg.Log.Format,
+		"STREAM_TOKEN_SECRET":   &cfg.Auth.TokenSecret,
+		"STREAM_API_KEYS_FILE":  &cfg.Auth.APIKeysFile,
+		"STREAM_ADMIN_TOKEN":    &cfg.Auth.AdminToken,
+		"STREAM_WEBHOOK_SECRET": &cfg.Webhooks.Secret,
+		"STREAM_OTLP_ENDPOINT":  &cfg.Tracing.OTLPEndpoint,
+		"STREAM_TURN_PUBLIC_IP": &cfg.TURN.PublicIP,
+		"STREAM_TURN_SECRET":    &cfg.TURN.Secret,
+		"STREAM_DIRECTORY":      &cfg.Cluster.Directory,
+		"STREAM_REDIS_URL":      &cfg.Cluster.RedisURL,
+		"STREAM_NODE_ID":        &cfg.Cluster.NodeID,
+		"STREAM_NODE_URL":       &cfg.Cluster.NodeURL,
+		"STREAM_STORAGE_PATH":   &cfg.Storage.Path,
+	}
+	for name, field := range stringVars {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	lists := map[string]*[]string{
+		"STREAM_CORS_ORIGINS":    &cfg.CORS.AllowedOrigins,
+		"STREAM_PUBLIC_IPS":      &cfg.RTC.PublicIPs,
+		"STREAM_WEBHOOK_URLS":    &cfg.Webhooks.URLs,
+		"STREAM_TRUSTED_PROXIES": &cfg.Server.TrustedProxies,
+	}
+	for name, field := range lists {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = splitList(value)
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"STREAM_SHUTDOWN_TIMEOUT": &cfg.Server.ShutdownTimeout,
+		"STREAM_TOKEN_TTL":        &cfg.Auth.TokenTTL,
+	}
+	for name, field := range durations {
+		if value, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*field = d
+		}
+	}
+
+	ints := map[string]*int{
+		"STREAM_ICE_UDP_PORT":   &cfg.RTC.ICEUDPPort,
+		"STREAM_ICE_TCP_PORT":   &cfg.RTC.ICETCPPort,
+		"STREAM_EDGE_THRESHOLD": &cfg.Cluster.EdgeThreshold,
+	}
+	for name, field := range ints {
+		if value, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*field = n
+		}
+	}
+
+	if value, ok := os.LookupEnv("STREAM_UDP_PORT_RANGE"); ok {
+		if err := (*portRangeValue)(&cfg.RTC).Set(value); err != nil {
+			return fmt.Errorf("STREAM_UDP_PORT_RANGE: %w", err)
+		}
+	}
+	if value, ok := os.LookupEnv("STREAM_ICE_SERVERS"); ok {
+		cfg.RTC.ICEServers = nil
+		for _, url := range splitList(value) {
+			cfg.RTC.ICEServers = append(cfg.RTC.ICEServers, ICEServer{URLs: []string{url}})
+		}
+	}
+
+	return nil
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// listValue is a flag.Value for comma-separated lists. Setting it replaces the
+// list rather than appending to it.
+type listValue []string
+
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	*l = splitList(value)
+	return nil
+}
+
+// portRangeValue is a flag.Value that sets the RTC UDP port range from
+// "min-max".
+type portRangeValue RTCConfig
+
+func (p *portRangeValue) String() string {
+	if p == nil || (p.UDPPortMin == 0 && p.UDPPortMax == 0) {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", p.UDPPortMin, p.UDPPortMax)
+}
+
+func (p *portRangeValue) Set(value string) error {
+	lo, hi, ok := strings.Cut(value, "-")
+	if !ok {
+		return fmt.Errorf("port range %q must be min-max", value)
+	}
+	portMin, err := strconv.ParseUint(strings.TrimSpace(lo), 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port range %q: %w", value, err)
+	}
+	portMax, err := strconv.ParseUint(strings.TrimSpace(hi), 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port range %q: %w", value, err)
+	}
+	p.UDPPortMin = uint16(portMin)
+	p.UDPPortMax = uint16(portMax)
+	return nil
+}
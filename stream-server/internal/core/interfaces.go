@@ -1,14 +1,18 @@
 package core
 
 import (
+	"context"
+
 	"github.com/pion/webrtc/v4"
 	"github.com/rs/zerolog"
 )
 
 type RTCConnection interface {
-	HandleSDPOffer(offer webrtc.SessionDescription, logger *zerolog.Logger) (webrtc.SessionDescription, error)
-	HandleSDPAnswer(answer webrtc.SessionDescription) error
+	HandleSDPOffer(ctx context.Context, offer webrtc.SessionDescription, logger *zerolog.Logger) (webrtc.SessionDescription, error)
+	HandleSDPAnswer(ctx context.Context, answer webrtc.SessionDescription, logger *zerolog.Logger) error
 	HandleICE(candidate webrtc.ICECandidateInit, logger *zerolog.Logger) error
+	UpdateTrackMetaData(tracksMetaData []IncomingTrackMetaData)
+	Stats() (RTCStats, error)
 
 	Close(logger *zerolog.Logger) error
 	GetPeerConnection() *webrtc.PeerConnection
@@ -0,0 +1,76 @@
+package core
+
+const (
+	RoleHost     = "host"
+	RoleGuest    = "guest"
+	RoleAudience = "audience"
+	// RoleRelay is carried by the tokens nodes use to relay a room's tracks
+	// between each other. It has no template, so clients cannot join with it.
+	RoleRelay = "relay"
+)
+
+const (
+	PermissionPublish   = "can_publish"
+	PermissionSubscribe = "can_subscribe"
+	PermissionChat      = "can_chat"
+	PermissionModerate  = "can_moderate"
+	PermissionRecord    = "can_record"
+)
+
+type Permissions struct {
+	CanPublish   bool `json:"can_publish"`
+	CanSubscribe bool `json:"can_subscribe"`
+	CanChat      bool `json:"can_chat"`
+	CanModerate  bool `json:"can_moderate"`
+	CanRecord    bool `json:"can_record"`
+}
+
+// Has reports whether the named permission is granted.
+func (p Permissions) Has(permission string) bool {
+	switch permission {
+	case PermissionPublish:
+		return p.CanPublish
+	case PermissionSubscribe:
+		return p.CanSubscribe
+	case PermissionChat:
+		return p.CanChat
+	case PermissionModerate:
+		return p.CanModerate
+	case PermissionRecord:
+		return p.CanRecord
+	default:
+		return false
+	}
+}
+
+// UsesPeerConnection reports whether a participant with these permissions
+// negotiates WebRTC with the server.
+func (p Permissions) UsesPeerConnection() bool {
+	return p.CanPublish || p.CanSubscribe
+}
+
+// RoleTemplates are the default permissions of each role. Rooms may override
+// them at creation.
+var RoleTemplates = map[string]Permissions{
+	RoleHost: {
+		CanPublish:   true,
+		CanSubscribe: true,
+		CanChat:      true,
+		CanModerate:  true,
+		CanRecord:    true,
+	},
+	RoleGuest: {
+		CanPublish:   true,
+		CanSubscribe: true,
+		CanChat:      true,
+	},
+	RoleAudience: {
+		CanSubscribe: true,
+		CanChat:      true,
+	},
+}
+
+func IsValidRole(role string) bool {
+	_, ok := RoleTemplates[role]
+	return ok
+}
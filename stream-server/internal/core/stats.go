@@ -0,0 +1,21 @@
+package core
+
+import "time"
+
+// RTCStats are cumulative counters for one peer connection. Rates are derived
+// by comparing two samples.
+type RTCStats struct {
+	Timestamp       time.Time
+	RoundTripTime   time.Duration
+	BytesReceived   uint64
+	BytesSent       uint64
+	PacketsReceived uint64
+	PacketsLost     int64
+	// JitterIn is the worst jitter of streams received from the peer, in
+	// seconds.
+	JitterIn float64
+	// JitterOut and FractionLostOut are the worst values the peer reported
+	// for streams the server sends it.
+	JitterOut       float64
+	FractionLostOut float64
+}
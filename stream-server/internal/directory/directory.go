@@ -0,0 +1,43 @@
+package directory
+
+import (
+	"context"
+	"time"
+)
+
+// Entry records which node owns a room.
+type Entry struct {
+	RoomID   string `json:"room_id"`
+	NodeID   string `json:"node_id"`
+	TenantID string `json:"tenant_id"`
+	// NodeURL is the owning node's public base URL, e.g.
+	// "https://node-1.example.com".
+	NodeURL   string    `json:"node_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NodeEntry advertises a live node and how loaded it is.
+type NodeEntry struct {
+	NodeID       string    `json:"node_id"`
+	NodeURL      string    `json:"node_url"`
+	Participants int       `json:"participants"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Directory is shared by every node of a cluster. A node claims a room before
+// creating it and releases it when the room closes; rooms of a node that stops
+// refreshing them expire.
+type Directory interface {
+	// Claim records entry unless the room is already owned by another node,
+	// in which case it returns that node's entry and false.
+	Claim(ctx context.Context, entry Entry) (Entry, bool, error)
+	Lookup(ctx context.Context, roomID string) (Entry, bool, error)
+	// Release removes the room if nodeID still owns it.
+	Release(ctx context.Context, roomID string, nodeID string) error
+	// Refresh extends the lease of entries, re-registering any that expired.
+	Refresh(ctx context.Context, entries []Entry) error
+	// Announce registers node or refreshes its lease; nodes expire like rooms.
+	Announce(ctx context.Context, node NodeEntry) error
+	Nodes(ctx context.Context) ([]NodeEntry, error)
+	Close() error
+}
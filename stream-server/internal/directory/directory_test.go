@@ -0,0 +1,166 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testTTL = time.Minute
+
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	dir, err := DialRedis(context.Background(), "redis://"+server.Addr(), "test:", testTTL)
+	if err != nil {
+		t.Fatalf("DialRedis: %v", err)
+	}
+	t.Cleanup(func() { dir.Close() })
+	return dir, server
+}
+
+// testDirectory runs the behaviour every directory must share.
+func testDirectory(t *testing.T, newDirectory func(t *testing.T) Directory) {
+	ctx := context.Background()
+	entry := func(roomID, nodeID string) Entry {
+		return Entry{RoomID: roomID, NodeID: nodeID, TenantID: "acme", NodeURL: "http://" + nodeID}
+	}
+
+	t.Run("claim", func(t *testing.T) {
+		dir := newDirectory(t)
+
+		if _, claimed, err := dir.Claim(ctx, entry("room-1", "node-1")); err != nil || !claimed {
+			t.Fatalf("Claim = %v, %v; want claimed", claimed, err)
+		}
+		// Claiming again from the same node succeeds.
+		if _, claimed, err := dir.Claim(ctx, entry("room-1", "node-1")); err != nil || !claimed {
+			t.Fatalf("second Claim by the owner = %v, %v; want claimed", claimed, err)
+		}
+
+		owner, claimed, err := dir.Claim(ctx, entry("room-1", "node-2"))
+		if err != nil || claimed {
+			t.Fatalf("Claim by another node = %v, %v; want not claimed", claimed, err)
+		}
+		if owner.NodeID != "node-1" || owner.NodeURL != "http://node-1" || owner.TenantID != "acme" {
+			t.Errorf("owner = %+v, want node-1's entry", owner)
+		}
+
+		got, ok, err := dir.Lookup(ctx, "room-1")
+		if err != nil || !ok || got.NodeID != "node-1" {
+			t.Errorf("Lookup = %+v, %v, %v; want node-1", got, ok, err)
+		}
+		if _, ok, err := dir.Lookup(ctx, "missing"); err != nil || ok {
+			t.Errorf("Lookup(missing) = %v, %v; want not found", ok, err)
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		dir := newDirectory(t)
+		dir.Claim(ctx, entry("room-1", "node-1"))
+
+		if err := dir.Release(ctx, "room-1", "node-2"); err != nil {
+			t.Fatalf("Release by another node: %v", err)
+		}
+		if _, ok, _ := dir.Lookup(ctx, "room-1"); !ok {
+			t.Fatal("a node that does not own the room released it")
+		}
+
+		if err := dir.Release(ctx, "room-1", "node-1"); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+		if _, ok, _ := dir.Lookup(ctx, "room-1"); ok {
+			t.Fatal("released room is still in the directory")
+		}
+		if _, claimed, _ := dir.Claim(ctx, entry("room-1", "node-2")); !claimed {
+			t.Error("released room could not be claimed by another node")
+		}
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		dir := newDirectory(t)
+		dir.Claim(ctx, entry("room-1", "node-1"))
+		dir.Claim(ctx, entry("room-2", "node-2"))
+
+		// room-3 lost its lease and is re-registered; room-2 belongs to
+		// another node and is left alone.
+		if err := dir.Refresh(ctx, []Entry{entry("room-1", "node-1"), entry("room-2", "node-1"), entry("room-3", "node-1")}); err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+		for roomID, nodeID := range map[string]string{"room-1": "node-1", "room-2": "node-2", "room-3": "node-1"} {
+			if got, ok, _ := dir.Lookup(ctx, roomID); !ok || got.NodeID != nodeID {
+				t.Errorf("%s owned by %+v, want %s", roomID, got, nodeID)
+			}
+		}
+		if err := dir.Refresh(ctx, nil); err != nil {
+			t.Errorf("Refresh(nil): %v", err)
+		}
+	})
+
+	t.Run("nodes", func(t *testing.T) {
+		dir := newDirectory(t)
+		if nodes, err := dir.Nodes(ctx); err != nil || len(nodes) != 0 {
+			t.Fatalf("Nodes = %+v, %v; want none", nodes, err)
+		}
+
+		dir.Announce(ctx, NodeEntry{NodeID: "node-1", Participants: 3})
+		dir.Announce(ctx, NodeEntry{NodeID: "node-2", Participants: 1})
+		dir.Announce(ctx, NodeEntry{NodeID: "node-1", Participants: 5})
+
+		nodes, err := dir.Nodes(ctx)
+		if err != nil {
+			t.Fatalf("Nodes: %v", err)
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+		if len(nodes) != 2 || nodes[0].Participants != 5 || nodes[1].Participants != 1 {
+			t.Errorf("Nodes = %+v, want node-1 with 5 and node-2 with 1", nodes)
+		}
+	})
+}
+
+func TestMemory(t *testing.T) {
+	testDirectory(t, func(t *testing.T) Directory { return NewMemory() })
+}
+
+func TestRedis(t *testing.T) {
+	testDirectory(t, func(t *testing.T) Directory {
+		dir, _ := newTestRedis(t)
+		return dir
+	})
+}
+
+func TestRedisLeaseExpires(t *testing.T) {
+	ctx := context.Background()
+	dir, server := newTestRedis(t)
+
+	dir.Claim(ctx, Entry{RoomID: "room-1", NodeID: "node-1"})
+	dir.Announce(ctx, NodeEntry{NodeID: "node-1"})
+	server.FastForward(testTTL + time.Second)
+
+	if _, ok, _ := dir.Lookup(ctx, "room-1"); ok {
+		t.Error("room outlived its lease")
+	}
+	if nodes, _ := dir.Nodes(ctx); len(nodes) != 0 {
+		t.Errorf("Nodes = %+v, want the expired node gone", nodes)
+	}
+	if _, claimed, _ := dir.Claim(ctx, Entry{RoomID: "room-1", NodeID: "node-2"}); !claimed {
+		t.Error("expired room could not be claimed by another node")
+	}
+}
+
+func TestRedisUnavailable(t *testing.T) {
+	ctx := context.Background()
+	dir, server := newTestRedis(t)
+	server.Close()
+
+	if _, _, err := dir.Claim(ctx, Entry{RoomID: "room-1", NodeID: "node-1"}); err == nil {
+		t.Error("Claim succeeded without a redis server")
+	}
+	if _, _, err := dir.Lookup(ctx, "room-1"); err == nil || errors.Is(err, redis.Nil) {
+		t.Errorf("Lookup error = %v, want a connection error", err)
+	}
+}
@@ -0,0 +1,85 @@
+package directory
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is a process-local directory. It is the default for a single node
+// and lets several room managers in one process act as a cluster.
+type Memory struct {
+	entries map[string]Entry
+	nodes   map[string]NodeEntry
+	mu      sync.RWMutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		entries: make(map[string]Entry),
+		nodes:   make(map[string]NodeEntry),
+	}
+}
+
+func (m *Memory) Claim(ctx context.Context, entry Entry) (Entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if owner, ok := m.entries[entry.RoomID]; ok && owner.NodeID != entry.NodeID {
+		return owner, false, nil
+	}
+	m.entries[entry.RoomID] = entry
+	return entry, true, nil
+}
+
+func (m *Memory) Lookup(ctx context.Context, roomID string) (Entry, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.entries[roomID]
+	return entry, ok, nil
+}
+
+func (m *Memory) Release(ctx context.Context, roomID string, nodeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[roomID]; ok && entry.NodeID == nodeID {
+		delete(m.entries, roomID)
+	}
+	return nil
+}
+
+func (m *Memory) Refresh(ctx context.Context, entries []Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, entry := range entries {
+		if owner, ok := m.entries[entry.RoomID]; !ok || owner.NodeID == entry.NodeID {
+			m.entries[entry.RoomID] = entry
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Announce(ctx context.Context, node NodeEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nodes[node.NodeID] = node
+	return nil
+}
+
+func (m *Memory) Nodes(ctx context.Context) ([]NodeEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	nodes := make([]NodeEntry, 0, len(m.nodes))
+	for _, node := range m.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
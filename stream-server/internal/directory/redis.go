@@ -0,0 +1,186 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis stores each room as a JSON value under prefix+"room:"+roomID and each
+// node under prefix+"node:"+nodeID, both with a TTL that the node refreshes.
+type Redis struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// releaseScript deletes the key only if ARGV[1] still owns it.
+var releaseScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if value and cjson.decode(value).node_id == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// refreshScript extends the key if ARGV[1] owns it and recreates it if it
+// expired. A room claimed by another node in the meantime is left alone.
+var refreshScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if not value or cjson.decode(value).node_id == ARGV[1] then
+	return redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+end
+return 0
+`)
+
+func NewRedis(client *redis.Client, prefix string, ttl time.Duration) *Redis {
+	return &Redis{
+		client: client,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+// DialRedis connects to the server at url, e.g. "redis://localhost:6379/0".
+func DialRedis(ctx context.Context, url string, prefix string, ttl time.Duration) (*Redis, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return NewRedis(client, prefix, ttl), nil
+}
+
+func (r *Redis) key(roomID string) string {
+	return r.prefix + "room:" + roomID
+}
+
+func (r *Redis) nodeKey(nodeID string) string {
+	return r.prefix + "node:" + nodeID
+}
+
+func (r *Redis) Claim(ctx context.Context, entry Entry) (Entry, bool, error) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	claimed, err := r.client.SetNX(ctx, r.key(entry.RoomID), value, r.ttl).Result()
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to claim room %s: %w", entry.RoomID, err)
+	}
+	if claimed {
+		return entry, true, nil
+	}
+
+	owner, ok, err := r.Lookup(ctx, entry.RoomID)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	if !ok {
+		// The previous owner's key expired between SETNX and GET.
+		return r.Claim(ctx, entry)
+	}
+	if owner.NodeID == entry.NodeID {
+		return entry, true, r.client.Set(ctx, r.key(entry.RoomID), value, r.ttl).Err()
+	}
+	return owner, false, nil
+}
+
+func (r *Redis) Lookup(ctx context.Context, roomID string) (Entry, bool, error) {
+	value, err := r.client.Get(ctx, r.key(roomID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to look up room %s: %w", roomID, err)
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return Entry{}, false, fmt.Errorf("invalid directory entry for room %s: %w", roomID, err)
+	}
+	return entry, true, nil
+}
+
+func (r *Redis) Release(ctx context.Context, roomID string, nodeID string) error {
+	if err := releaseScript.Run(ctx, r.client, []string{r.key(roomID)}, nodeID).Err(); err != nil {
+		return fmt.Errorf("failed to release room %s: %w", roomID, err)
+	}
+	return nil
+}
+
+func (r *Redis) Refresh(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+	for _, entry := range entries {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		refreshScript.Eval(ctx, pipe, []string{r.key(entry.RoomID)}, entry.NodeID, value, r.ttl.Milliseconds())
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to refresh %d rooms: %w", len(entries), err)
+	}
+	return nil
+}
+
+func (r *Redis) Announce(ctx context.Context, node NodeEntry) error {
+	value, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Set(ctx, r.nodeKey(node.NodeID), value, r.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to announce node %s: %w", node.NodeID, err)
+	}
+	return nil
+}
+
+func (r *Redis) Nodes(ctx context.Context) ([]NodeEntry, error) {
+	var keys []string
+	iter := r.client.Scan(ctx, 0, r.nodeKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	nodes := make([]NodeEntry, 0, len(values))
+	for _, value := range values {
+		// Keys that expired since the scan come back as nil.
+		raw, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var node NodeEntry
+		if err := json.Unmarshal([]byte(raw), &node); err != nil {
+			return nil, fmt.Errorf("invalid node entry: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -13,7 +13,7 @@ type contextKey string
 
 const LoggerKey contextKey = "logger"
 
-func newLogger(logLevel string) *zerolog.Logger {
+func newLogger(logLevel string, format string) *zerolog.Logger {
 
 	level, err := zerolog.ParseLevel(logLevel)
 	if err != nil {
@@ -26,6 +26,11 @@ func newLogger(logLevel string) *zerolog.Logger {
 
 	var logger zerolog.Logger
 
+	if format == "json" {
+		logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+		return &logger
+	}
+
 	output := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "2006-01-02 15:04:05"}
 
 	output.FormatLevel = func(i interface{}) string {
@@ -67,8 +72,8 @@ func newLogger(logLevel string) *zerolog.Logger {
 
 }
 
-func InitLogger(logLevel string, ctx context.Context) (*zerolog.Logger, context.Context) {
-	logger := newLogger(logLevel)
+func InitLogger(logLevel string, format string, ctx context.Context) (*zerolog.Logger, context.Context) {
+	logger := newLogger(logLevel, format)
 	ctx = context.WithValue(ctx, LoggerKey, logger)
 
 	return logger, ctx
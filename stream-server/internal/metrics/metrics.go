@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const Namespace = "stream"
+
+// Registry holds every metric exposed on /metrics. Packages add counters here
+// and scrape-time collectors are registered from main.
+var Registry = prometheus.NewRegistry()
+
+var (
+	RTPPacketsForwarded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "rtp_packets_forwarded_total",
+		Help:      "RTP packets read from publishers and written to room tracks.",
+	}, []string{"kind"})
+
+	RTPBytesForwarded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "rtp_bytes_forwarded_total",
+		Help:      "RTP bytes read from publishers and written to room tracks.",
+	}, []string{"kind"})
+
+	SignalingMessagesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "signaling_messages_dropped_total",
+		Help:      "Signaling messages dropped because the participant's send channel was full.",
+	}, []string{"path"})
+
+	NegotiationRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "negotiation_retries_total",
+		Help:      "Server offers that had to be renegotiated.",
+	}, []string{"reason"})
+
+	WebSocketErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "websocket_errors_total",
+		Help:      "WebSocket upgrade, read and write errors.",
+	}, []string{"op"})
+
+	RelayLinks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "relay_links",
+		Help:      "Open server-to-server links relaying room tracks.",
+	})
+
+	RelayPackets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "relay_packets_total",
+		Help:      "RTP packets sent, received or dropped on server-to-server relay links.",
+	}, []string{"direction"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RTPPacketsForwarded,
+		RTPBytesForwarded,
+		SignalingMessagesDropped,
+		NegotiationRetries,
+		WebSocketErrors,
+		RelayLinks,
+		RelayPackets,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
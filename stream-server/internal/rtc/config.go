@@ -0,0 +1,44 @@
+package rtc
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+type Config struct {
+	// TrickleICE answers offers as soon as the local description is set and
+	// relies on OnICECandidate to deliver the server's candidates.
+	TrickleICE       bool
+	GatheringTimeout time.Duration
+	ICEServers       []webrtc.ICEServer
+	// UDPPortMin and UDPPortMax bound the ports used for ICE host candidates.
+	// Both zero lets the OS pick.
+	UDPPortMin uint16
+	UDPPortMax uint16
+	// PublicIPs replace the host candidate addresses when the server runs
+	// behind a 1:1 NAT.
+	PublicIPs []string
+	// ICEUDPPort and ICETCPPort carry ICE for every peer connection on a
+	// single port each. Zero disables the mux.
+	ICEUDPPort int
+	ICETCPPort int
+	// ICEServersFunc adds servers whose credentials are issued per connection,
+	// such as the embedded TURN server.
+	ICEServersFunc func() []webrtc.ICEServer
+	// SettingEngine is built from the fields above by NewSettingEngine. Peer
+	// connections use pion's defaults when it is nil.
+	SettingEngine *SettingEngine
+}
+
+func DefaultConfig() Config {
+	return Config{
+		TrickleICE:       false,
+		GatheringTimeout: 5 * time.Second,
+		ICEServers: []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.l.google.com:19302"},
+			},
+		},
+	}
+}
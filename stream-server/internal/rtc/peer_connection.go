@@ -1,12 +1,18 @@
 package rtc
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"stream-server/internal/core"
+	"stream-server/internal/tracing"
+	"sync"
 	"time"
 
+	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/webrtc/v4"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Signaller interface {
@@ -14,28 +20,37 @@ type Signaller interface {
 }
 
 type PionRTCConnection struct {
-	conn      *webrtc.PeerConnection
-	handler   core.RTCEventHandler
-	signaller Signaller
+	conn           *webrtc.PeerConnection
+	handler        core.RTCEventHandler
+	signaller      Signaller
+	tracksMetaData []core.IncomingTrackMetaData
+	claimedTracks  map[string]bool
+	config         Config
+	statsGetter    stats.Getter
+	mu             sync.Mutex
 }
 
-func NewPionRTCConnection(handler core.RTCEventHandler, tracksMetaData []core.IncomingTrackMetaData, logger *zerolog.Logger, signaller Signaller) (*PionRTCConnection, error) {
+func NewPionRTCConnection(handler core.RTCEventHandler, tracksMetaData []core.IncomingTrackMetaData, rtcConfig Config, logger *zerolog.Logger, signaller Signaller) (*PionRTCConnection, error) {
 	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-		},
+		ICEServers: rtcConfig.ICEServers,
+	}
+	if rtcConfig.ICEServersFunc != nil {
+		config.ICEServers = append(slices.Clone(config.ICEServers), rtcConfig.ICEServersFunc()...)
 	}
 
-	pc, err := webrtc.NewPeerConnection(config)
+	pc, statsGetter, err := newPeerConnection(config, rtcConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	rtcConn := &PionRTCConnection{
-		conn:    pc,
-		handler: handler,
+		conn:           pc,
+		handler:        handler,
+		signaller:      signaller,
+		tracksMetaData: tracksMetaData,
+		claimedTracks:  make(map[string]bool),
+		config:         rtcConfig,
+		statsGetter:    statsGetter,
 	}
 
 	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
@@ -51,21 +66,15 @@ func NewPionRTCConnection(handler core.RTCEventHandler, tracksMetaData []core.In
 		logger.Debug().Str("track_kind", track.Kind().String()).Str("track_id", track.ID()).Msg("Got remote track")
 
 		kind := track.Kind().String()
-		var participantID, participantName, clientTrackID string
-		for _, trackMetaData := range tracksMetaData {
-			if trackMetaData.Kind == kind {
-				participantID = trackMetaData.ParticipantID
-				participantName = trackMetaData.ParticipantName
-				clientTrackID = trackMetaData.ClientTrackID
-				logger.Debug().Str("client_track_id", clientTrackID).Str("kind", kind).Str("participant_id", participantID).Msg("forwarding track")
-				break
-			}
-		}
+		participantID, participantName, clientTrackID := rtcConn.claimTrackMetaData(track)
+		logger.Debug().Str("client_track_id", clientTrackID).Str("kind", kind).Str("participant_id", participantID).Msg("forwarding track")
 		//signaller.SignalPeerConnections(logger)
 		if err := handler.ForwardTracks(track, participantID, participantName, kind, clientTrackID, receiver, logger); err != nil {
 			logger.Error().Err(err)
 		}
 
+		rtcConn.releaseTrackMetaData(clientTrackID)
+
 	})
 
 	pc.OnConnectionStateChange(func(p webrtc.PeerConnectionState) {
@@ -85,42 +94,101 @@ func NewPionRTCConnection(handler core.RTCEventHandler, tracksMetaData []core.In
 
 }
 
-func (rc *PionRTCConnection) HandleSDPOffer(sdp webrtc.SessionDescription, logger *zerolog.Logger) (webrtc.SessionDescription, error) {
+// UpdateTrackMetaData replaces the metadata used to label tracks that arrive
+// through a renegotiation of the existing peer connection.
+func (rc *PionRTCConnection) UpdateTrackMetaData(tracksMetaData []core.IncomingTrackMetaData) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.tracksMetaData = tracksMetaData
+}
+
+func (rc *PionRTCConnection) claimTrackMetaData(track *webrtc.TrackRemote) (string, string, string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	for _, trackMetaData := range rc.tracksMetaData {
+		if trackMetaData.ClientTrackID == track.ID() && !rc.claimedTracks[trackMetaData.ClientTrackID] {
+			rc.claimedTracks[trackMetaData.ClientTrackID] = true
+			return trackMetaData.ParticipantID, trackMetaData.ParticipantName, trackMetaData.ClientTrackID
+		}
+	}
+
+	kind := track.Kind().String()
+	for _, trackMetaData := range rc.tracksMetaData {
+		if rc.claimedTracks[trackMetaData.ClientTrackID] {
+			continue
+		}
+		if trackMetaData.Kind == kind || (trackMetaData.Kind == "screen" && track.Kind() == webrtc.RTPCodecTypeVideo) {
+			rc.claimedTracks[trackMetaData.ClientTrackID] = true
+			return trackMetaData.ParticipantID, trackMetaData.ParticipantName, trackMetaData.ClientTrackID
+		}
+	}
+
+	return "", "", ""
+}
+
+func (rc *PionRTCConnection) releaseTrackMetaData(clientTrackID string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	delete(rc.claimedTracks, clientTrackID)
+}
+
+func (rc *PionRTCConnection) HandleSDPOffer(ctx context.Context, sdp webrtc.SessionDescription, logger *zerolog.Logger) (webrtc.SessionDescription, error) {
+	ctx, span := tracing.Start(ctx, "rtc.HandleSDPOffer", attribute.Bool("trickle_ice", rc.config.TrickleICE))
+	defer span.End()
+
 	if err := rc.conn.SetRemoteDescription(sdp); err != nil {
+		tracing.RecordError(span, err)
 		return webrtc.SessionDescription{}, err
 	}
 
 	answer, err := rc.conn.CreateAnswer(nil)
 	if err != nil {
+		tracing.RecordError(span, err)
 		return webrtc.SessionDescription{}, err
 	}
 
+	if rc.config.TrickleICE {
+		if err := rc.conn.SetLocalDescription(answer); err != nil {
+			tracing.RecordError(span, err)
+			return webrtc.SessionDescription{}, err
+		}
+		return answer, nil
+	}
+
 	gatherComplete := webrtc.GatheringCompletePromise(rc.conn)
 	if err := rc.conn.SetLocalDescription(answer); err != nil {
+		tracing.RecordError(span, err)
 		return webrtc.SessionDescription{}, err
 	}
 
+	_, gatherSpan := tracing.Start(ctx, "rtc.ICEGathering")
 	select {
 	case <-gatherComplete:
-	case <-time.After(5 * time.Second):
+	case <-time.After(rc.config.GatheringTimeout):
+		gatherSpan.SetAttributes(attribute.Bool("timed_out", true))
+		logger.Warn().Dur("timeout", rc.config.GatheringTimeout).Msg("ICE gathering did not complete before timeout, answering with partial candidates")
 	}
+	gatherSpan.End()
 
 	return *rc.conn.LocalDescription(), nil
 }
 
-func (rc *PionRTCConnection) HandleSDPAnswer(sdp webrtc.SessionDescription) error {
+func (rc *PionRTCConnection) HandleSDPAnswer(ctx context.Context, sdp webrtc.SessionDescription, logger *zerolog.Logger) error {
+	_, span := tracing.Start(ctx, "rtc.HandleSDPAnswer")
+	defer span.End()
+
 	if err := rc.conn.SetRemoteDescription(sdp); err != nil {
+		tracing.RecordError(span, err)
 		return err
 	}
 	return nil
 }
-func (rc *PionRTCConnection) HandleICE(candidate webrtc.ICECandidateInit, logger *zerolog.Logger) error {
-	if err := rc.conn.AddICECandidate(candidate); err != nil {
-		return err
-	}
-
-	return nil
 
+// HandleICE adds a remote candidate. Candidates must not arrive before the
+// remote description; the caller buffers them until then.
+func (rc *PionRTCConnection) HandleICE(candidate webrtc.ICECandidateInit, logger *zerolog.Logger) error {
+	return rc.conn.AddICECandidate(candidate)
 }
 
 func (rc *PionRTCConnection) Close(logger *zerolog.Logger) error {
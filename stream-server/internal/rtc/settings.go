@@ -0,0 +1,74 @@
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog"
+)
+
+// SettingEngine is shared by every peer connection so that ICE traffic uses the
+// configured mux ports instead of per-connection ephemeral ports.
+type SettingEngine struct {
+	engine webrtc.SettingEngine
+	udpMux *ice.MultiUDPMuxDefault
+	tcpMux ice.TCPMux
+}
+
+// NewSettingEngine opens the ICE mux listeners described by config. Close
+// releases them once every peer connection is closed.
+func NewSettingEngine(config Config, logger *zerolog.Logger) (*SettingEngine, error) {
+	s := &SettingEngine{}
+
+	if config.UDPPortMin != 0 || config.UDPPortMax != 0 {
+		if err := s.engine.SetEphemeralUDPPortRange(config.UDPPortMin, config.UDPPortMax); err != nil {
+			return nil, fmt.Errorf("invalid UDP port range: %w", err)
+		}
+	}
+	if len(config.PublicIPs) > 0 {
+		s.engine.SetNAT1To1IPs(config.PublicIPs, webrtc.ICECandidateTypeHost)
+	}
+
+	if config.ICEUDPPort != 0 {
+		udpMux, err := ice.NewMultiUDPMuxFromPort(config.ICEUDPPort)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen for ICE on UDP port %d: %w", config.ICEUDPPort, err)
+		}
+		s.udpMux = udpMux
+		s.engine.SetICEUDPMux(udpMux)
+		logger.Info().Int("port", config.ICEUDPPort).Msg("ICE UDP mux listening")
+	}
+
+	if config.ICETCPPort != 0 {
+		listener, err := net.ListenTCP("tcp", &net.TCPAddr{Port: config.ICETCPPort})
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to listen for ICE on TCP port %d: %w", config.ICETCPPort, err)
+		}
+		s.tcpMux = webrtc.NewICETCPMux(nil, listener, 8)
+		s.engine.SetICETCPMux(s.tcpMux)
+		s.engine.SetNetworkTypes([]webrtc.NetworkType{
+			webrtc.NetworkTypeUDP4,
+			webrtc.NetworkTypeUDP6,
+			webrtc.NetworkTypeTCP4,
+			webrtc.NetworkTypeTCP6,
+		})
+		logger.Info().Int("port", config.ICETCPPort).Msg("ICE TCP mux listening")
+	}
+
+	return s, nil
+}
+
+func (s *SettingEngine) Close() error {
+	var errs []error
+	if s.udpMux != nil {
+		errs = append(errs, s.udpMux.Close())
+	}
+	if s.tcpMux != nil {
+		errs = append(errs, s.tcpMux.Close())
+	}
+	return errors.Join(errs...)
+}
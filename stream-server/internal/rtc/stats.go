@@ -0,0 +1,108 @@
+package rtc
+
+import (
+	"fmt"
+	"stream-server/internal/core"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/stats"
+	"github.com/pion/webrtc/v4"
+)
+
+// newPeerConnection creates a peer connection with the default interceptors
+// plus the stats interceptor, whose getter exposes per-SSRC RTP counters that
+// PeerConnection.GetStats does not report.
+func newPeerConnection(config webrtc.Configuration, rtcConfig Config) (*webrtc.PeerConnection, stats.Getter, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+		return nil, nil, err
+	}
+
+	registry := &interceptor.Registry{}
+	statsFactory, err := stats.NewInterceptor()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var statsGetter stats.Getter
+	statsFactory.OnNewPeerConnection(func(_ string, getter stats.Getter) {
+		statsGetter = getter
+	})
+	registry.Add(statsFactory)
+
+	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, registry); err != nil {
+		return nil, nil, err
+	}
+
+	// The setting engine is copied into the API; the muxes it references stay
+	// shared.
+	var settingEngine webrtc.SettingEngine
+	if rtcConfig.SettingEngine != nil {
+		settingEngine = rtcConfig.SettingEngine.engine
+	}
+
+	api := webrtc.NewAPI(
+		webrtc.WithMediaEngine(mediaEngine),
+		webrtc.WithInterceptorRegistry(registry),
+		webrtc.WithSettingEngine(settingEngine),
+	)
+	pc, err := api.NewPeerConnection(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pc, statsGetter, nil
+}
+
+func (rc *PionRTCConnection) Stats() (core.RTCStats, error) {
+	pc := rc.GetPeerConnection()
+	getter := rc.statsGetter
+	if pc == nil || getter == nil {
+		return core.RTCStats{}, fmt.Errorf("peer connection is closed")
+	}
+
+	result := core.RTCStats{Timestamp: time.Now()}
+
+	for _, receiver := range pc.GetReceivers() {
+		for _, track := range receiver.Tracks() {
+			s := getter.Get(uint32(track.SSRC()))
+			if s == nil {
+				continue
+			}
+			result.BytesReceived += s.InboundRTPStreamStats.BytesReceived
+			result.PacketsReceived += s.InboundRTPStreamStats.PacketsReceived
+			result.PacketsLost += s.InboundRTPStreamStats.PacketsLost
+
+			// The interceptor keeps inbound jitter in RTP timestamp units.
+			if clockRate := track.Codec().ClockRate; clockRate > 0 {
+				result.JitterIn = max(result.JitterIn, s.InboundRTPStreamStats.Jitter/float64(clockRate))
+			}
+		}
+	}
+
+	var remoteRTT time.Duration
+	for _, sender := range pc.GetSenders() {
+		for _, encoding := range sender.GetParameters().Encodings {
+			s := getter.Get(uint32(encoding.SSRC))
+			if s == nil {
+				continue
+			}
+			result.BytesSent += s.OutboundRTPStreamStats.BytesSent
+			result.JitterOut = max(result.JitterOut, s.RemoteInboundRTPStreamStats.Jitter)
+			result.FractionLostOut = max(result.FractionLostOut, s.RemoteInboundRTPStreamStats.FractionLost)
+			remoteRTT = max(remoteRTT, s.RemoteInboundRTPStreamStats.RoundTripTime)
+		}
+	}
+
+	result.RoundTripTime = remoteRTT
+	for _, report := range pc.GetStats() {
+		pair, ok := report.(webrtc.ICECandidatePairStats)
+		if ok && pair.Nominated && pair.CurrentRoundTripTime > 0 {
+			result.RoundTripTime = time.Duration(pair.CurrentRoundTripTime * float64(time.Second))
+			break
+		}
+	}
+
+	return result, nil
+}
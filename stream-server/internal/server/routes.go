@@ -1,6 +1,9 @@
 package server
 
 import (
+	"stream-server/internal/core"
+	"stream-server/internal/metrics"
+	"stream-server/internal/tracing"
 	"stream-server/internal/transport/api"
 	ws "stream-server/internal/transport/websocket"
 
@@ -12,22 +15,73 @@ func (s *Server) RegisterRoutes() {
 	r := chi.NewRouter()
 
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedOrigins:   s.options.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-Key"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
+	r.Use(tracing.Middleware)
+	r.Use(api.ForwardedProto(s.options.TrustedProxies))
 
 	//Health Check
+	r.Get("/healthz", api.HealthzHandler())
+	r.Get("/readyz", api.ReadyzHandler(s.roomManager))
+
+	//Admin
+	r.With(api.RequireAdmin(s.roomManager, s.options.AdminToken, s.options.TLSClientCAFile != "")).
+		Post("/drain", api.DrainHandler(s.roomManager)) // POST /drain
+
+	//Metrics
+	r.Handle("/metrics", metrics.Handler())
 
 	//Room
 	r.Route("/rooms", func(r chi.Router) {
-		r.Post("/", api.CreateRoomHandler(s.roomManager))            // POST /rooms
-		r.Post("/{roomId}/join", api.JoinRoomHandler(s.roomManager)) // POST /rooms/{id}/join
-		r.Get("/{roomId}/ws", ws.HandleWebSocket(s.roomManager))
+		// Not redirected: the join response may point at an edge node of the room.
+		r.Get("/{roomId}/ws", ws.HandleWebSocket(s.roomManager, s.tokens))
+
+		// Inline so that {roomId} is resolved before the redirect check.
+		r.Group(func(r chi.Router) {
+			r.Use(api.RedirectToOwner(s.roomManager))
+
+			r.With(api.RequireAPIKey(s.roomManager, s.apiKeys)).
+				Post("/{roomId}/join", api.JoinRoomHandler(s.roomManager, s.tokens, s.turn, s.store)) // POST /rooms/{id}/join
+
+			r.Group(func(r chi.Router) {
+				r.Use(api.RequireAPIKey(s.roomManager, s.apiKeys))
+
+				r.Post("/", api.CreateRoomHandler(s.roomManager, s.store)) // POST /rooms
+				r.Get("/", api.ListRoomsHandler(s.roomManager))            // GET /rooms
+				r.Get("/{roomId}", api.GetRoomHandler(s.roomManager))      // GET /rooms/{id}
+
+				r.Get("/{roomId}/participants/{participantId}/stats", api.GetParticipantStatsHandler(s.roomManager))
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(api.RequireAPIKeyOrRoomToken(s.roomManager, s.apiKeys, s.tokens, core.PermissionModerate))
+
+				r.Patch("/{roomId}", api.UpdateRoomHandler(s.roomManager, s.store)) // PATCH /rooms/{id}
+				r.Delete("/{roomId}", api.DeleteRoomHandler(s.roomManager))         // DELETE /rooms/{id}
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(api.RequireRoomToken(s.roomManager, s.tokens, core.PermissionModerate))
+
+				r.Post("/{roomId}/participants/{participantId}/kick", api.KickParticipantHandler(s.roomManager))
+				r.Post("/{roomId}/participants/{participantId}/role", api.ChangeRoleHandler(s.roomManager))
+				r.Post("/{roomId}/bans", api.BanUserHandler(s.roomManager))
+				r.Post("/{roomId}/invites", api.CreateInviteHandler(s.roomManager, s.store))
+			})
+		})
 	})
 
+	//Relay
+	r.Get("/relay/rooms/{roomId}", ws.HandleRelay(s.roomManager, s.tokens))
+
+	//Webhooks
+	r.With(api.RequireAPIKey(s.roomManager, s.apiKeys)).
+		Get("/webhooks/deliveries", api.ListWebhookDeliveriesHandler(s.webhooks)) // GET /webhooks/deliveries
+
 	s.httpServer.Handler = r
 }
@@ -6,7 +6,13 @@ import (
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
+	"net/netip"
+	"stream-server/internal/auth"
+	"stream-server/internal/storage"
 	"stream-server/internal/streaming"
+	"stream-server/internal/turnserver"
+	"stream-server/internal/webhook"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -15,21 +21,62 @@ type Server struct {
 	httpServer  *http.Server
 	logger      *zerolog.Logger
 	roomManager *streaming.RoomManager
+	tokens      *auth.TokenIssuer
+	apiKeys     *auth.APIKeyStore
+	webhooks    *webhook.Dispatcher
+	turn        *turnserver.Server
+	store       storage.Store
+	options     Options
 }
 
-func NewServer(logger *zerolog.Logger, rm *streaming.RoomManager) *Server {
+type Options struct {
+	// AdminToken guards admin routes such as /drain; empty disables them.
+	AdminToken     string
+	AllowedOrigins []string
+	// TLSCertFile and TLSKeyFile switch the server to HTTPS when set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile enables client certificate verification; admin routes
+	// then require a verified certificate.
+	TLSClientCAFile   string
+	TLSReloadInterval time.Duration
+	// TrustedProxies may set X-Forwarded-Proto.
+	TrustedProxies []netip.Prefix
+}
+
+func NewServer(logger *zerolog.Logger, rm *streaming.RoomManager, tokens *auth.TokenIssuer, apiKeys *auth.APIKeyStore, webhooks *webhook.Dispatcher, turn *turnserver.Server, store storage.Store, options Options) *Server {
 	return &Server{
 		logger:      logger,
 		roomManager: rm,
+		tokens:      tokens,
+		apiKeys:     apiKeys,
+		webhooks:    webhooks,
+		turn:        turn,
+		store:       store,
+		options:     options,
 	}
 
 }
 
-func (s *Server) SetupServer(addr string) {
+// SetupServer prepares the HTTP server. With TLS configured the certificate is
+// loaded now and reloaded until ctx is done.
+func (s *Server) SetupServer(ctx context.Context, addr string) error {
 	s.httpServer = &http.Server{
-		Addr: ":" + addr,
+		Addr: addr,
+	}
+
+	if s.options.TLSCertFile == "" {
+		return nil
 	}
 
+	reloader, err := newCertReloader(s.logger, s.options.TLSCertFile, s.options.TLSKeyFile, s.options.TLSClientCAFile)
+	if err != nil {
+		return err
+	}
+	s.httpServer.TLSConfig = reloader.TLSConfig()
+	go reloader.Watch(ctx, s.options.TLSReloadInterval)
+
+	return nil
 }
 
 func (s *Server) StartServer() error {
@@ -37,22 +84,49 @@ func (s *Server) StartServer() error {
 		return errors.New("http server is not initialized")
 	}
 
-	s.logger.Info().Str("port", s.httpServer.Addr).Msg("started HTTP server")
+	if s.httpServer.TLSConfig != nil {
+		s.logger.Info().Str("addr", s.httpServer.Addr).Bool("client_auth", s.options.TLSClientCAFile != "").Msg("started HTTPS server")
+		return s.httpServer.ListenAndServeTLS("", "")
+	}
+
+	s.logger.Info().Str("addr", s.httpServer.Addr).Msg("started HTTP server")
 
 	return s.httpServer.ListenAndServe()
 }
 
 func (s *Server) StartPprofServer(addr string) {
 	go func() {
-		s.logger.Info().Str("pprof_port", addr).Msg("pprof server started")
-		if err := http.ListenAndServe("localhost:"+addr, nil); err != nil && err != http.ErrServerClosed {
+		s.logger.Info().Str("pprof_addr", addr).Msg("pprof server started")
+		if err := http.ListenAndServe(addr, nil); err != nil && err != http.ErrServerClosed {
 			s.logger.Fatal().Err(err).Msg("failed to start pprof server")
 		}
 	}()
 }
 
+// drainShare is the part of the shutdown budget a drain in progress may use.
+// The rest is kept for delivering the rooms' final events and shutting the
+// HTTP server down.
+const drainShare = 0.75
+
+// StopServer waits for a drain in progress to finish before closing the
+// remaining rooms and shutting the HTTP server down.
 func (s *Server) StopServer(ctx context.Context) error {
+	if s.roomManager.IsDraining() {
+		drainCtx := ctx
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			drainCtx, cancel = context.WithTimeout(ctx, time.Duration(float64(time.Until(deadline))*drainShare))
+			defer cancel()
+		}
+		if err := s.roomManager.WaitForDrain(drainCtx); err != nil {
+			s.logger.Warn().Err(err).Msg("closing rooms before drain completed")
+		}
+	}
 	s.roomManager.CloseAllRooms()
+	s.roomManager.Events().Close(ctx)
+	if s.webhooks != nil {
+		s.webhooks.Stop(ctx)
+	}
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		return fmt.Errorf("failed to shutdown HTTP server: %w", err)
 	}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// certReloader serves the current certificate and client CA pool and swaps
+// them on SIGHUP or when the files change on disk. A failed reload keeps the
+// previous material.
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	current      atomic.Pointer[tlsMaterial]
+	logger       *zerolog.Logger
+}
+
+type tlsMaterial struct {
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  []time.Time
+}
+
+func newCertReloader(logger *zerolog.Logger, certFile string, keyFile string, clientCAFile string) (*certReloader, error) {
+	cr := &certReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		logger:       logger,
+	}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *certReloader) files() []string {
+	files := []string{cr.certFile, cr.keyFile}
+	if cr.clientCAFile != "" {
+		files = append(files, cr.clientCAFile)
+	}
+	return files
+}
+
+func (cr *certReloader) modTimes() ([]time.Time, error) {
+	var times []time.Time
+	for _, file := range cr.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, info.ModTime())
+	}
+	return times, nil
+}
+
+func (cr *certReloader) reload() error {
+	modTimes, err := cr.modTimes()
+	if err != nil {
+		return fmt.Errorf("failed to stat TLS files: %w", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	material := &tlsMaterial{cert: &cert, modTimes: modTimes}
+	if cr.clientCAFile != "" {
+		pem, err := os.ReadFile(cr.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		material.clientCAs = x509.NewCertPool()
+		if !material.clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %s", cr.clientCAFile)
+		}
+	}
+
+	cr.current.Store(material)
+	return nil
+}
+
+// changed reports whether any file has a different modification time than the
+// loaded material.
+func (cr *certReloader) changed() bool {
+	modTimes, err := cr.modTimes()
+	if err != nil {
+		return false
+	}
+	loaded := cr.current.Load().modTimes
+	for i := range modTimes {
+		if !modTimes[i].Equal(loaded[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads on SIGHUP and polls the files every interval until ctx is done.
+func (cr *certReloader) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var reason string
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reason = "sighup"
+		case <-ticker.C:
+			if !cr.changed() {
+				continue
+			}
+			reason = "file_changed"
+		}
+
+		if err := cr.reload(); err != nil {
+			cr.logger.Error().Err(err).Str("reason", reason).Msg("failed to reload TLS certificate, keeping the previous one")
+			continue
+		}
+		cr.logger.Info().Str("reason", reason).Str("cert_file", cr.certFile).Msg("reloaded TLS certificate")
+	}
+}
+
+// TLSConfig returns a config that resolves the certificate and client CAs on
+// every handshake. Client certificates are optional at the TLS layer and
+// enforced per route.
+func (cr *certReloader) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cr.current.Load().cert, nil
+		},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		material := cr.current.Load()
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.Certificates = []tls.Certificate{*material.cert}
+		if material.clientCAs != nil {
+			config.ClientCAs = material.clientCAs
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		return config, nil
+	}
+	return base
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"stream-server/internal/streaming"
+
+	"github.com/rs/zerolog"
+)
+
+const recordTimeout = 5 * time.Second
+
+// Recorder writes the session and publication history of rooms to a store.
+// It is meant to be subscribed to the room event bus, which calls it from the
+// subscription's own goroutine, so writes happen in event order. It also
+// persists room changes that must not be lost or reordered, so it is set as
+// the room manager's persister too.
+type Recorder struct {
+	store  Store
+	logger *zerolog.Logger
+}
+
+func NewRecorder(logger *zerolog.Logger, store Store) *Recorder {
+	return &Recorder{
+		store:  store,
+		logger: logger,
+	}
+}
+
+func (r *Recorder) HandleEvent(event streaming.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+
+	var err error
+	switch event.Type {
+	case streaming.EventParticipantJoined:
+		err = r.store.StartSession(ctx, sessionOf(event))
+	case streaming.EventParticipantLeft:
+		err = r.store.EndSession(ctx, event.RoomID, event.ParticipantID, event.Timestamp)
+	case streaming.EventRoleChanged:
+		if err = r.store.EndSession(ctx, event.RoomID, event.ParticipantID, event.Timestamp); err == nil {
+			err = r.store.StartSession(ctx, sessionOf(event))
+		}
+	case streaming.EventTrackPublished:
+		err = r.store.StartPublication(ctx, Publication{
+			RoomID:        event.RoomID,
+			ParticipantID: event.ParticipantID,
+			TrackID:       event.TrackID,
+			Kind:          event.Kind,
+			PublishedAt:   event.Timestamp,
+		})
+	case streaming.EventTrackUnpublished:
+		err = r.store.EndPublication(ctx, event.RoomID, event.TrackID, event.Timestamp)
+	}
+	if err != nil {
+		r.logger.Error().Err(err).Str("event", string(event.Type)).Str("room_id", event.RoomID).Msg("failed to record room event")
+	}
+}
+
+// RoomChanged saves the room's current bans and invites.
+func (r *Recorder) RoomChanged(room *streaming.Room) {
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+
+	if err := r.store.SaveRoom(ctx, NewRoom(room)); err != nil {
+		r.logger.Error().Err(err).Str("room_id", room.ID).Msg("failed to save room")
+	}
+}
+
+// RoomClosed marks the room closed so that it is not restored.
+func (r *Recorder) RoomClosed(room *streaming.Room, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+
+	if err := r.store.CloseRoom(ctx, room.ID, at); err != nil {
+		r.logger.Error().Err(err).Str("room_id", room.ID).Msg("failed to close room")
+	}
+}
+
+func sessionOf(event streaming.Event) Session {
+	return Session{
+		RoomID:          event.RoomID,
+		ParticipantID:   event.ParticipantID,
+		ParticipantName: event.ParticipantName,
+		Role:            event.Role,
+		JoinedAt:        event.Timestamp,
+	}
+}
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS rooms (
+	id            TEXT PRIMARY KEY,
+	name          TEXT NOT NULL,
+	created_by    TEXT NOT NULL,
+	tenant_id     TEXT NOT NULL,
+	policy        TEXT NOT NULL,
+	passcode_hash BLOB,
+	invite_only   INTEGER NOT NULL,
+	invited_users TEXT NOT NULL,
+	invites       TEXT NOT NULL,
+	host_key_hash BLOB,
+	bans          TEXT NOT NULL DEFAULT '[]',
+	created_at    DATETIME NOT NULL,
+	closed_at     DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id               INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id          TEXT NOT NULL,
+	participant_id   TEXT NOT NULL,
+	participant_name TEXT NOT NULL,
+	role             TEXT NOT NULL,
+	joined_at        DATETIME NOT NULL,
+	left_at          DATETIME
+);
+CREATE INDEX IF NOT EXISTS sessions_room ON sessions (room_id, participant_id);
+
+CREATE TABLE IF NOT EXISTS publications (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id        TEXT NOT NULL,
+	participant_id TEXT NOT NULL,
+	track_id       TEXT NOT NULL,
+	kind           TEXT NOT NULL,
+	published_at   DATETIME NOT NULL,
+	unpublished_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS publications_room ON publications (room_id, track_id);
+`
+
+// SQLite stores rooms in a single database file.
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the database at path. Sessions and publications
+// left open by a previous run are ended, since none of their participants
+// survived the restart.
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite allows one writer at a time; a single connection avoids busy
+	// errors between our own goroutines.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if _, err := db.Exec(`UPDATE sessions SET left_at = ? WHERE left_at IS NULL`, now); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to end stale sessions: %w", err)
+	}
+	if _, err := db.Exec(`UPDATE publications SET unpublished_at = ? WHERE unpublished_at IS NULL`, now); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to end stale publications: %w", err)
+	}
+
+	return &SQLite{db: db}, nil
+}
+
+func (s *SQLite) SaveRoom(ctx context.Context, room Room) error {
+	policy, err := json.Marshal(room.Policy)
+	if err != nil {
+		return fmt.Errorf("failed to encode room policy: %w", err)
+	}
+	invitedUsers, err := json.Marshal(room.Access.InvitedUsers)
+	if err != nil {
+		return fmt.Errorf("failed to encode invited users: %w", err)
+	}
+	invites, err := json.Marshal(room.Access.Invites)
+	if err != nil {
+		return fmt.Errorf("failed to encode invites: %w", err)
+	}
+	bans, err := json.Marshal(room.Bans)
+	if err != nil {
+		return fmt.Errorf("failed to encode bans: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO rooms (id, name, created_by, tenant_id, policy, passcode_hash, invite_only, invited_users, invites, host_key_hash, bans, created_at, closed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			created_by = excluded.created_by,
+			tenant_id = excluded.tenant_id,
+			policy = excluded.policy,
+			passcode_hash = excluded.passcode_hash,
+			invite_only = excluded.invite_only,
+			invited_users = excluded.invited_users,
+			invites = excluded.invites,
+			host_key_hash = excluded.host_key_hash,
+			bans = excluded.bans,
+			created_at = excluded.created_at,
+			closed_at = excluded.closed_at`,
+		room.ID, room.Name, room.CreatedBy, room.TenantID, string(policy), room.Access.PasscodeHash,
+		room.Access.InviteOnly, string(invitedUsers), string(invites), room.Access.HostKeyHash, string(bans), room.CreatedAt.UTC(), nullTime(room.ClosedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save room %s: %w", room.ID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetRoom(ctx context.Context, roomID string) (Room, error) {
+	var (
+		room         Room
+		policy       string
+		invitedUsers string
+		invites      string
+		bans         string
+		closedAt     sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, created_by, tenant_id, policy, passcode_hash, invite_only, invited_users, invites, host_key_hash, bans, created_at, closed_at
+		FROM rooms WHERE id = ?`, roomID,
+	).Scan(
+		&room.ID, &room.Name, &room.CreatedBy, &room.TenantID, &policy, &room.Access.PasscodeHash,
+		&room.Access.InviteOnly, &invitedUsers, &invites, &room.Access.HostKeyHash, &bans, &room.CreatedAt, &closedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Room{}, ErrNotFound
+	}
+	if err != nil {
+		return Room{}, fmt.Errorf("failed to load room %s: %w", roomID, err)
+	}
+
+	if err := json.Unmarshal([]byte(policy), &room.Policy); err != nil {
+		return Room{}, fmt.Errorf("invalid policy of room %s: %w", roomID, err)
+	}
+	if err := json.Unmarshal([]byte(invitedUsers), &room.Access.InvitedUsers); err != nil {
+		return Room{}, fmt.Errorf("invalid invited users of room %s: %w", roomID, err)
+	}
+	if err := json.Unmarshal([]byte(invites), &room.Access.Invites); err != nil {
+		return Room{}, fmt.Errorf("invalid invites of room %s: %w", roomID, err)
+	}
+	if err := json.Unmarshal([]byte(bans), &room.Bans); err != nil {
+		return Room{}, fmt.Errorf("invalid bans of room %s: %w", roomID, err)
+	}
+	if closedAt.Valid {
+		room.ClosedAt = closedAt.Time
+	}
+	return room, nil
+}
+
+func (s *SQLite) CloseRoom(ctx context.Context, roomID string, at time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE rooms SET closed_at = ? WHERE id = ?`, at.UTC(), roomID); err != nil {
+		return fmt.Errorf("failed to close room %s: %w", roomID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) StartSession(ctx context.Context, session Session) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO sessions (room_id, participant_id, participant_name, role, joined_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		session.RoomID, session.ParticipantID, session.ParticipantName, session.Role, session.JoinedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start session of %s in room %s: %w", session.ParticipantID, session.RoomID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) EndSession(ctx context.Context, roomID string, participantID string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE sessions SET left_at = ?
+		WHERE room_id = ? AND participant_id = ? AND left_at IS NULL`,
+		at.UTC(), roomID, participantID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to end session of %s in room %s: %w", participantID, roomID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) Sessions(ctx context.Context, roomID string) ([]Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, room_id, participant_id, participant_name, role, joined_at, left_at
+		FROM sessions WHERE room_id = ? ORDER BY id`, roomID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions of room %s: %w", roomID, err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var (
+			session Session
+			leftAt  sql.NullTime
+		)
+		if err := rows.Scan(&session.ID, &session.RoomID, &session.ParticipantID, &session.ParticipantName, &session.Role, &session.JoinedAt, &leftAt); err != nil {
+			return nil, fmt.Errorf("failed to read session: %w", err)
+		}
+		if leftAt.Valid {
+			session.LeftAt = leftAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLite) StartPublication(ctx context.Context, publication Publication) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO publications (room_id, participant_id, track_id, kind, published_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		publication.RoomID, publication.ParticipantID, publication.TrackID, publication.Kind, publication.PublishedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record publication of track %s in room %s: %w", publication.TrackID, publication.RoomID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) EndPublication(ctx context.Context, roomID string, trackID string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE publications SET unpublished_at = ?
+		WHERE room_id = ? AND track_id = ? AND unpublished_at IS NULL`,
+		at.UTC(), roomID, trackID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to end publication of track %s in room %s: %w", trackID, roomID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) Publications(ctx context.Context, roomID string) ([]Publication, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, room_id, participant_id, track_id, kind, published_at, unpublished_at
+		FROM publications WHERE room_id = ? ORDER BY id`, roomID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list publications of room %s: %w", roomID, err)
+	}
+	defer rows.Close()
+
+	var publications []Publication
+	for rows.Next() {
+		var (
+			publication   Publication
+			unpublishedAt sql.NullTime
+		)
+		if err := rows.Scan(&publication.ID, &publication.RoomID, &publication.ParticipantID, &publication.TrackID, &publication.Kind, &publication.PublishedAt, &unpublishedAt); err != nil {
+			return nil, fmt.Errorf("failed to read publication: %w", err)
+		}
+		if unpublishedAt.Valid {
+			publication.UnpublishedAt = unpublishedAt.Time
+		}
+		publications = append(publications, publication)
+	}
+	return publications, rows.Err()
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"stream-server/internal/core"
+	"stream-server/internal/rtc"
+	"stream-server/internal/streaming"
+
+	"github.com/rs/zerolog"
+)
+
+func openTestStore(t *testing.T, path string) *SQLite {
+	t.Helper()
+	store, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteRoomRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := openTestStore(t, filepath.Join(t.TempDir(), "rooms.db"))
+
+	if _, err := store.GetRoom(ctx, "missing"); err != ErrNotFound {
+		t.Fatalf("GetRoom(missing) error = %v, want ErrNotFound", err)
+	}
+
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	room := Room{
+		ID:        "room-1",
+		Name:      "Room",
+		CreatedBy: "host",
+		TenantID:  "acme",
+		Policy:    streaming.RoomPolicy{MaxDuration: time.Hour, RoleCapacity: map[string]int{core.RoleGuest: 4}},
+		Access: streaming.AccessPolicy{
+			PasscodeHash: []byte("hash"),
+			InviteOnly:   true,
+			InvitedUsers: []string{"alice"},
+			Invites:      []streaming.Invite{{Code: "code", Role: core.RoleGuest, SingleUse: true}},
+			HostKeyHash:  []byte("host-key"),
+		},
+		Bans:      []string{"mallory"},
+		CreatedAt: createdAt,
+	}
+	if err := store.SaveRoom(ctx, room); err != nil {
+		t.Fatalf("SaveRoom: %v", err)
+	}
+
+	got, err := store.GetRoom(ctx, "room-1")
+	if err != nil {
+		t.Fatalf("GetRoom: %v", err)
+	}
+	if got.Name != "Room" || got.TenantID != "acme" || !got.CreatedAt.Equal(createdAt) || !got.ClosedAt.IsZero() {
+		t.Errorf("GetRoom = %+v", got)
+	}
+	if got.Policy.MaxDuration != time.Hour || got.Policy.RoleCapacity[core.RoleGuest] != 4 {
+		t.Errorf("policy = %+v", got.Policy)
+	}
+	if string(got.Access.PasscodeHash) != "hash" || string(got.Access.HostKeyHash) != "host-key" ||
+		!got.Access.InviteOnly || len(got.Access.InvitedUsers) != 1 || len(got.Access.Invites) != 1 {
+		t.Errorf("access = %+v", got.Access)
+	}
+	if len(got.Bans) != 1 || got.Bans[0] != "mallory" {
+		t.Errorf("bans = %v, want [mallory]", got.Bans)
+	}
+
+	closedAt := createdAt.Add(time.Hour)
+	if err := store.CloseRoom(ctx, "room-1", closedAt); err != nil {
+		t.Fatalf("CloseRoom: %v", err)
+	}
+	if got, _ := store.GetRoom(ctx, "room-1"); !got.ClosedAt.Equal(closedAt) {
+		t.Errorf("closed at %v, want %v", got.ClosedAt, closedAt)
+	}
+}
+
+func TestSQLiteEndsStaleHistoryOnOpen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rooms.db")
+
+	store, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	now := time.Now()
+	if err := store.StartSession(ctx, Session{RoomID: "room-1", ParticipantID: "alice", Role: core.RoleGuest, JoinedAt: now}); err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	if err := store.StartPublication(ctx, Publication{RoomID: "room-1", ParticipantID: "alice", TrackID: "track-1", Kind: "audio", PublishedAt: now}); err != nil {
+		t.Fatalf("StartPublication: %v", err)
+	}
+	store.Close()
+
+	reopened := openTestStore(t, path)
+	sessions, err := reopened.Sessions(ctx, "room-1")
+	if err != nil || len(sessions) != 1 || sessions[0].LeftAt.IsZero() {
+		t.Errorf("Sessions = %+v, %v; want one ended session", sessions, err)
+	}
+	publications, err := reopened.Publications(ctx, "room-1")
+	if err != nil || len(publications) != 1 || publications[0].UnpublishedAt.IsZero() {
+		t.Errorf("Publications = %+v, %v; want one ended publication", publications, err)
+	}
+}
+
+func TestRecorderPersistsRoomChanges(t *testing.T) {
+	ctx := context.Background()
+	logger := zerolog.Nop()
+	store := openTestStore(t, filepath.Join(t.TempDir(), "rooms.db"))
+	recorder := NewRecorder(&logger, store)
+
+	rm := streaming.NewRoomManager(&logger, rtc.DefaultConfig(), streaming.DefaultRoomPolicy())
+	rm.SetPersister(recorder)
+	t.Cleanup(rm.CloseAllRooms)
+
+	room, _, err := rm.CreateRoom("room-1", "Room", "host", "default", streaming.RoomPolicy{})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	invite, err := room.CreateInvite(core.RoleGuest, 0, true)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	if err := store.SaveRoom(ctx, NewRoom(room)); err != nil {
+		t.Fatalf("SaveRoom: %v", err)
+	}
+
+	if err := room.ConsumeInvite(invite.Code, core.RoleGuest); err != nil {
+		t.Fatalf("ConsumeInvite: %v", err)
+	}
+	if err := room.BanUser("mallory", "spam", &logger); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+
+	stored, err := store.GetRoom(ctx, "room-1")
+	if err != nil {
+		t.Fatalf("GetRoom: %v", err)
+	}
+	if len(stored.Access.Invites) != 0 {
+		t.Errorf("stored invites = %+v, want the used invite gone", stored.Access.Invites)
+	}
+	if len(stored.Bans) != 1 || stored.Bans[0] != "mallory" {
+		t.Errorf("stored bans = %v, want [mallory]", stored.Bans)
+	}
+
+	// A restored room keeps its bans.
+	restarted := streaming.NewRoomManager(&logger, rtc.DefaultConfig(), streaming.DefaultRoomPolicy())
+	t.Cleanup(restarted.CloseAllRooms)
+	restored, _, err := restarted.RestoreRoom(stored.ID, stored.Name, stored.CreatedBy, stored.TenantID, stored.CreatedAt, stored.RoomPolicy(), stored.Bans)
+	if err != nil {
+		t.Fatalf("RestoreRoom: %v", err)
+	}
+	if !restored.IsBanned("mallory") {
+		t.Error("restored room lost its ban")
+	}
+
+	// Deleting the room closes it before the call returns.
+	rm.DeleteRoom("room-1")
+	if stored, _ := store.GetRoom(ctx, "room-1"); stored.ClosedAt.IsZero() {
+		t.Error("deleted room was not closed in storage")
+	}
+}
+
+func TestRecorderKeepsShutdownRoomsOpen(t *testing.T) {
+	ctx := context.Background()
+	logger := zerolog.Nop()
+	store := openTestStore(t, filepath.Join(t.TempDir(), "rooms.db"))
+
+	rm := streaming.NewRoomManager(&logger, rtc.DefaultConfig(), streaming.DefaultRoomPolicy())
+	rm.SetPersister(NewRecorder(&logger, store))
+
+	room, _, err := rm.CreateRoom("room-1", "Room", "host", "default", streaming.RoomPolicy{})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if err := store.SaveRoom(ctx, NewRoom(room)); err != nil {
+		t.Fatalf("SaveRoom: %v", err)
+	}
+
+	rm.CloseAllRooms()
+	if stored, _ := store.GetRoom(ctx, "room-1"); !stored.ClosedAt.IsZero() {
+		t.Error("room closed by a shutdown was marked closed")
+	}
+}
+
+func TestRecorderHistory(t *testing.T) {
+	ctx := context.Background()
+	logger := zerolog.Nop()
+	store := openTestStore(t, filepath.Join(t.TempDir(), "rooms.db"))
+	recorder := NewRecorder(&logger, store)
+
+	now := time.Now()
+	for _, event := range []streaming.Event{
+		{Type: streaming.EventParticipantJoined, RoomID: "room-1", ParticipantID: "alice", Role: core.RoleGuest, Timestamp: now},
+		{Type: streaming.EventTrackPublished, RoomID: "room-1", ParticipantID: "alice", TrackID: "track-1", Kind: "video", Timestamp: now},
+		{Type: streaming.EventRoleChanged, RoomID: "room-1", ParticipantID: "alice", Role: core.RoleAudience, Timestamp: now.Add(time.Second)},
+		{Type: streaming.EventTrackUnpublished, RoomID: "room-1", TrackID: "track-1", Timestamp: now.Add(time.Second)},
+		{Type: streaming.EventParticipantLeft, RoomID: "room-1", ParticipantID: "alice", Timestamp: now.Add(2 * time.Second)},
+	} {
+		recorder.HandleEvent(event)
+	}
+
+	sessions, err := store.Sessions(ctx, "room-1")
+	if err != nil {
+		t.Fatalf("Sessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].Role != core.RoleGuest || sessions[1].Role != core.RoleAudience {
+		t.Fatalf("Sessions = %+v, want a guest and an audience session", sessions)
+	}
+	for _, session := range sessions {
+		if session.LeftAt.IsZero() {
+			t.Errorf("session %+v was not ended", session)
+		}
+	}
+
+	publications, err := store.Publications(ctx, "room-1")
+	if err != nil {
+		t.Fatalf("Publications: %v", err)
+	}
+	if len(publications) != 1 || publications[0].UnpublishedAt.IsZero() {
+		t.Errorf("Publications = %+v, want one ended publication", publications)
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"stream-server/internal/streaming"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Room is the stored definition of a room, enough to recreate it after a
+// restart.
+type Room struct {
+	ID        string
+	Name      string
+	CreatedBy string
+	TenantID  string
+	// Policy is stored without its Access field; see Access.
+	Policy    streaming.RoomPolicy
+	Access    streaming.AccessPolicy
+	Bans      []string
+	CreatedAt time.Time
+	// ClosedAt is zero while the room is open.
+	ClosedAt time.Time
+}
+
+// Session is one stay of a participant in a room under one role. A role
+// change ends the session and starts another.
+type Session struct {
+	ID              int64
+	RoomID          string
+	ParticipantID   string
+	ParticipantName string
+	Role            string
+	JoinedAt        time.Time
+	LeftAt          time.Time
+}
+
+type Publication struct {
+	ID            int64
+	RoomID        string
+	ParticipantID string
+	TrackID       string
+	Kind          string
+	PublishedAt   time.Time
+	UnpublishedAt time.Time
+}
+
+// Store persists rooms and their history.
+type Store interface {
+	// SaveRoom inserts the room or replaces its definition.
+	SaveRoom(ctx context.Context, room Room) error
+	// GetRoom returns ErrNotFound for rooms that were never saved.
+	GetRoom(ctx context.Context, roomID string) (Room, error)
+	CloseRoom(ctx context.Context, roomID string, at time.Time) error
+	StartSession(ctx context.Context, session Session) error
+	// EndSession ends the open session of the participant in the room.
+	EndSession(ctx context.Context, roomID string, participantID string, at time.Time) error
+	Sessions(ctx context.Context, roomID string) ([]Session, error)
+	StartPublication(ctx context.Context, publication Publication) error
+	// EndPublication ends the open publication of the track in the room.
+	EndPublication(ctx context.Context, roomID string, trackID string, at time.Time) error
+	Publications(ctx context.Context, roomID string) ([]Publication, error)
+	Close() error
+}
+
+// NewRoom captures the current definition of room.
+func NewRoom(room *streaming.Room) Room {
+	policy := room.GetPolicy()
+	policy.Access = streaming.AccessPolicy{}
+	return Room{
+		ID:        room.ID,
+		Name:      room.GetName(),
+		CreatedBy: room.CreatedBy,
+		TenantID:  room.TenantID,
+		Policy:    policy,
+		Access:    room.AccessPolicy(),
+		Bans:      room.BannedUsers(),
+		CreatedAt: room.CreatedAt,
+	}
+}
+
+// RoomPolicy returns the policy to recreate the room with.
+func (r Room) RoomPolicy() streaming.RoomPolicy {
+	policy := r.Policy
+	policy.Access = r.Access
+	return policy
+}
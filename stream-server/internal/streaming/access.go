@@ -0,0 +1,269 @@
+package streaming
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"stream-server/internal/core"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasscodeRequired = errors.New("room passcode required")
+	ErrInvalidPasscode  = errors.New("invalid room passcode")
+	ErrNotInvited       = errors.New("room is invite-only")
+	ErrInvalidInvite    = errors.New("invite code is invalid or expired")
+	ErrInvalidHostKey   = errors.New("invalid host key")
+	ErrHostUserID       = errors.New("user id is reserved for the host")
+)
+
+// Credentials are what a user presents to join a room.
+type Credentials struct {
+	Passcode   string
+	InviteCode string
+	HostKey    string
+}
+
+type AccessPolicy struct {
+	Passcode string
+	// PasscodeHash restores a passcode returned by Room.AccessPolicy. Passcode
+	// takes precedence.
+	PasscodeHash []byte
+	InviteOnly   bool
+	InvitedUsers []string
+	// Invites restores invite codes returned by Room.AccessPolicy.
+	Invites []Invite
+	// HostKeyHash restores the host key issued by Room.IssueHostKey.
+	HostKeyHash []byte
+}
+
+type Invite struct {
+	Code      string
+	Role      string
+	ExpiresAt time.Time
+	SingleUse bool
+	used      bool
+}
+
+type roomAccess struct {
+	passcodeHash []byte
+	inviteOnly   bool
+	invitedUsers map[string]bool
+	invites      map[string]*Invite
+	hostKeyHash  []byte
+}
+
+func newRoomAccess(policy AccessPolicy) (roomAccess, error) {
+	access := roomAccess{
+		inviteOnly:   policy.InviteOnly,
+		invitedUsers: make(map[string]bool),
+		invites:      make(map[string]*Invite),
+		hostKeyHash:  policy.HostKeyHash,
+	}
+
+	if policy.Passcode != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(policy.Passcode), bcrypt.DefaultCost)
+		if err != nil {
+			return roomAccess{}, fmt.Errorf("failed to hash room passcode: %w", err)
+		}
+		access.passcodeHash = hash
+	} else if len(policy.PasscodeHash) > 0 {
+		access.passcodeHash = policy.PasscodeHash
+	}
+
+	for _, userID := range policy.InvitedUsers {
+		access.invitedUsers[userID] = true
+	}
+	for _, invite := range policy.Invites {
+		access.invites[invite.Code] = &invite
+	}
+
+	return access, nil
+}
+
+// SetAccessPolicy replaces the room's passcode and invite list. Invite codes
+// already issued remain valid.
+func (r *Room) SetAccessPolicy(policy AccessPolicy) error {
+	access, err := newRoomAccess(policy)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	access.invites = r.access.invites
+	access.hostKeyHash = r.access.hostKeyHash
+	r.access = access
+	return nil
+}
+
+// AccessPolicy returns the room's access rules in a form that can be stored:
+// the passcode only as its hash and only invites that can still be used.
+func (r *Room) AccessPolicy() AccessPolicy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	policy := AccessPolicy{
+		PasscodeHash: r.access.passcodeHash,
+		InviteOnly:   r.access.inviteOnly,
+		HostKeyHash:  r.access.hostKeyHash,
+	}
+	for userID := range r.access.invitedUsers {
+		policy.InvitedUsers = append(policy.InvitedUsers, userID)
+	}
+	sort.Strings(policy.InvitedUsers)
+
+	now := time.Now()
+	for _, invite := range r.access.invites {
+		if invite.used || (!invite.ExpiresAt.IsZero() && now.After(invite.ExpiresAt)) {
+			continue
+		}
+		policy.Invites = append(policy.Invites, *invite)
+	}
+	return policy
+}
+
+// IsProtected reports whether joining requires a passcode, an invitation or an
+// invite code.
+func (r *Room) IsProtected() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.access.passcodeHash != nil || r.access.inviteOnly
+}
+
+// IssueHostKey generates the secret the creator must present to join as host,
+// replacing any earlier one. Only its hash is kept.
+func (r *Room) IssueHostKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate host key: %w", err)
+	}
+	key := base64.RawURLEncoding.EncodeToString(buf)
+	hash := sha256.Sum256([]byte(key))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.access.hostKeyHash = hash[:]
+	return key, nil
+}
+
+// CheckHostKey reports whether key is the room's host key.
+func (r *Room) CheckHostKey(key string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if key == "" || r.access.hostKeyHash == nil {
+		return false
+	}
+	hash := sha256.Sum256([]byte(key))
+	return subtle.ConstantTimeCompare(hash[:], r.access.hostKeyHash) == 1
+}
+
+func (r *Room) CreateInvite(role string, ttl time.Duration, singleUse bool) (Invite, error) {
+	if role != "guest" && role != "audience" {
+		return Invite{}, fmt.Errorf("invites can only be issued for guest or audience roles")
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return Invite{}, fmt.Errorf("failed to generate invite code: %w", err)
+	}
+
+	invite := &Invite{
+		Code:      base64.RawURLEncoding.EncodeToString(buf),
+		Role:      role,
+		SingleUse: singleUse,
+	}
+	if ttl > 0 {
+		invite.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for code, existing := range r.access.invites {
+		if existing.used || (!existing.ExpiresAt.IsZero() && now.After(existing.ExpiresAt)) {
+			delete(r.access.invites, code)
+		}
+	}
+	r.access.invites[invite.Code] = invite
+
+	return *invite, nil
+}
+
+// CheckAccess validates a join request against the room's access rules. The
+// host proves itself with the host key; everyone else needs a valid invite
+// code, or an invitation and the passcode where the room requires them.
+// Single-use invites are not consumed here, see ConsumeInvite.
+func (r *Room) CheckAccess(userID string, role string, credentials Credentials) error {
+	if role == core.RoleHost {
+		if !r.IsHost(userID) || !r.CheckHostKey(credentials.HostKey) {
+			return ErrInvalidHostKey
+		}
+		return nil
+	}
+	// Only the host key may claim the host's user id, since host privileges
+	// and the host's connection follow it.
+	if r.IsHost(userID) {
+		return ErrHostUserID
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if credentials.InviteCode != "" {
+		if !r.access.validInviteLocked(credentials.InviteCode, role) {
+			return ErrInvalidInvite
+		}
+		return nil
+	}
+
+	if r.access.inviteOnly && !r.access.invitedUsers[userID] {
+		return ErrNotInvited
+	}
+
+	if r.access.passcodeHash != nil {
+		if credentials.Passcode == "" {
+			return ErrPasscodeRequired
+		}
+		if bcrypt.CompareHashAndPassword(r.access.passcodeHash, []byte(credentials.Passcode)) != nil {
+			return ErrInvalidPasscode
+		}
+	}
+
+	return nil
+}
+
+// ConsumeInvite uses up a single-use invite once a join it admitted has been
+// accepted. It fails if the invite was used or expired in the meantime.
+func (r *Room) ConsumeInvite(code string, role string) error {
+	r.mu.Lock()
+	if !r.access.validInviteLocked(code, role) {
+		r.mu.Unlock()
+		return ErrInvalidInvite
+	}
+	invite := r.access.invites[code]
+	if !invite.SingleUse {
+		r.mu.Unlock()
+		return nil
+	}
+	invite.used = true
+	r.mu.Unlock()
+
+	r.persistChanges()
+	return nil
+}
+
+func (a *roomAccess) validInviteLocked(code string, role string) bool {
+	invite, ok := a.invites[code]
+	return ok && !invite.used && invite.Role == role &&
+		(invite.ExpiresAt.IsZero() || time.Now().Before(invite.ExpiresAt))
+}
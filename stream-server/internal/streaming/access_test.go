@@ -0,0 +1,95 @@
+package streaming
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"stream-server/internal/core"
+	"stream-server/internal/rtc"
+
+	"github.com/rs/zerolog"
+)
+
+func TestHostCannotBeImpersonated(t *testing.T) {
+	logger := zerolog.Nop()
+	rm := NewRoomManager(&logger, rtc.DefaultConfig(), DefaultRoomPolicy())
+	t.Cleanup(rm.CloseAllRooms)
+	room, _, err := rm.CreateRoom("room-1", "Room", "host", DefaultTenantID, RoomPolicy{})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	hostKey, err := room.IssueHostKey()
+	if err != nil {
+		t.Fatalf("IssueHostKey: %v", err)
+	}
+
+	for _, role := range []string{core.RoleGuest, core.RoleAudience} {
+		if err := room.CheckAccess("host", role, Credentials{}); !errors.Is(err, ErrHostUserID) {
+			t.Errorf("CheckAccess(host, %s) = %v, want ErrHostUserID", role, err)
+		}
+	}
+	if err := room.CheckAccess("host", core.RoleHost, Credentials{}); !errors.Is(err, ErrInvalidHostKey) {
+		t.Errorf("CheckAccess without the host key = %v, want ErrInvalidHostKey", err)
+	}
+	if err := room.CheckAccess("host", core.RoleHost, Credentials{HostKey: hostKey}); err != nil {
+		t.Errorf("CheckAccess with the host key: %v", err)
+	}
+
+	host := &Participant{
+		ID:          "host",
+		Role:        core.RoleHost,
+		Permissions: room.PermissionsForRole(core.RoleHost),
+		Conn:        &scriptConn{msgs: make(chan []byte)},
+		Room:        room,
+		SendChan:    make(chan core.Message, 16),
+		JoinedAt:    time.Now(),
+	}
+	if err := room.AddParticipant(host, &logger); err != nil {
+		t.Fatalf("AddParticipant: %v", err)
+	}
+
+	if err := room.ReplaceParticipant("host", core.RoleGuest, &logger); !errors.Is(err, ErrParticipantConnected) {
+		t.Errorf("ReplaceParticipant with another role = %v, want ErrParticipantConnected", err)
+	}
+	if room.GetParticipantCount() != 1 {
+		t.Fatal("a connection with another role disconnected the host")
+	}
+	if err := room.ReplaceParticipant("host", core.RoleHost, &logger); err != nil || room.GetParticipantCount() != 0 {
+		t.Errorf("ReplaceParticipant with the same role = %v, %d participants left", err, room.GetParticipantCount())
+	}
+}
+
+func TestChangedRoleOutlivesToken(t *testing.T) {
+	logger := zerolog.Nop()
+	rm := NewRoomManager(&logger, rtc.DefaultConfig(), DefaultRoomPolicy())
+	t.Cleanup(rm.CloseAllRooms)
+	room, _, err := rm.CreateRoom("room-1", "Room", "host", DefaultTenantID, RoomPolicy{})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	guest := room.PermissionsForRole(core.RoleGuest)
+	if err := room.AddParticipant(&Participant{
+		ID:          "alice",
+		Role:        core.RoleGuest,
+		Permissions: guest,
+		Conn:        &scriptConn{msgs: make(chan []byte)},
+		Room:        room,
+		SendChan:    make(chan core.Message, 16),
+		JoinedAt:    time.Now(),
+	}, &logger); err != nil {
+		t.Fatalf("AddParticipant: %v", err)
+	}
+	if err := room.ChangeRole("alice", core.RoleAudience, &logger); err != nil {
+		t.Fatalf("ChangeRole: %v", err)
+	}
+
+	role, permissions := room.RoleOf("alice", core.RoleGuest, guest)
+	if role != core.RoleAudience || permissions.CanPublish {
+		t.Errorf("reconnecting with the guest token gives %s %+v, want audience", role, permissions)
+	}
+	if role, _ := room.RoleOf("bob", core.RoleGuest, guest); role != core.RoleGuest {
+		t.Errorf("RoleOf(bob) = %s, want the token's role", role)
+	}
+}
@@ -0,0 +1,141 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"stream-server/internal/directory"
+)
+
+// Node identifies this server in the room directory.
+type Node struct {
+	ID string
+	// URL is the base URL clients use to reach this node directly. When empty
+	// the node is addressed through whatever host the request came in on.
+	URL string
+}
+
+const directoryTimeout = 5 * time.Second
+
+// ErrDirectoryUnavailable wraps failures to reach the room directory.
+var ErrDirectoryUnavailable = errors.New("room directory unavailable")
+
+// SetDirectory replaces the default in-memory directory. It must be called
+// before any room is created.
+func (rm *RoomManager) SetDirectory(dir directory.Directory, node Node) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.directory = dir
+	rm.node = node
+}
+
+func (rm *RoomManager) Node() Node {
+	return rm.node
+}
+
+// HasRoom reports whether this node owns roomID. Edge copies of rooms owned
+// elsewhere do not count.
+func (rm *RoomManager) HasRoom(roomID string) bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	room, ok := rm.Rooms[roomID]
+	return ok && !room.IsEdge()
+}
+
+func (rm *RoomManager) directoryEntry(roomID string, tenantID string, createdAt time.Time) directory.Entry {
+	return directory.Entry{
+		RoomID:    roomID,
+		NodeID:    rm.node.ID,
+		TenantID:  tenantID,
+		NodeURL:   rm.node.URL,
+		CreatedAt: createdAt,
+	}
+}
+
+// claimRoom registers this node as the room's owner. It returns false if
+// another node already owns the room.
+func (rm *RoomManager) claimRoom(roomID string, tenantID string, createdAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), directoryTimeout)
+	defer cancel()
+
+	owner, claimed, err := rm.directory.Claim(ctx, rm.directoryEntry(roomID, tenantID, createdAt))
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrDirectoryUnavailable, err)
+	}
+	if !claimed {
+		rm.logger.Debug().Str("room_id", roomID).Str("owner_node", owner.NodeID).Msg("room id already owned by another node")
+	}
+	return claimed, nil
+}
+
+func (rm *RoomManager) releaseRoom(roomID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), directoryTimeout)
+	defer cancel()
+
+	if err := rm.directory.Release(ctx, roomID, rm.node.ID); err != nil {
+		rm.logger.Warn().Err(err).Str("room_id", roomID).Msg("failed to release room in directory")
+	}
+}
+
+// LookupRemoteRoom returns the directory entry of a room owned by another
+// node.
+func (rm *RoomManager) LookupRemoteRoom(ctx context.Context, roomID string) (directory.Entry, bool, error) {
+	entry, ok, err := rm.directory.Lookup(ctx, roomID)
+	if err != nil || !ok || entry.NodeID == rm.node.ID {
+		return directory.Entry{}, false, err
+	}
+	return entry, true, nil
+}
+
+// StartDirectoryHeartbeat refreshes this node's rooms in the directory so they
+// do not expire while the node is alive.
+func (rm *RoomManager) StartDirectoryHeartbeat(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		rm.logger.Info().Dur("interval", interval).Str("node_id", rm.node.ID).Msg("directory heartbeat started")
+		rm.refreshDirectory()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				rm.refreshDirectory()
+			}
+		}
+	}()
+}
+
+func (rm *RoomManager) refreshDirectory() {
+	rooms := rm.ListRooms()
+	entries := make([]directory.Entry, 0, len(rooms))
+	participants := 0
+	for _, room := range rooms {
+		participants += room.GetParticipantCount()
+		if room.IsEdge() {
+			continue
+		}
+		entries = append(entries, rm.directoryEntry(room.ID, room.TenantID, room.CreatedAt))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), directoryTimeout)
+	defer cancel()
+
+	if err := rm.directory.Refresh(ctx, entries); err != nil {
+		rm.logger.Warn().Err(err).Int("rooms", len(entries)).Msg("failed to refresh rooms in directory")
+	}
+
+	node := directory.NodeEntry{
+		NodeID:       rm.node.ID,
+		NodeURL:      rm.node.URL,
+		Participants: participants,
+		UpdatedAt:    time.Now(),
+	}
+	if err := rm.directory.Announce(ctx, node); err != nil {
+		rm.logger.Warn().Err(err).Msg("failed to announce node in directory")
+	}
+}
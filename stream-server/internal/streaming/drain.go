@@ -0,0 +1,73 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"stream-server/internal/core"
+)
+
+var ErrDraining = errors.New("server is draining, not accepting new rooms")
+
+const drainPollInterval = time.Second
+
+// IsDraining reports whether the node has stopped accepting new rooms.
+func (rm *RoomManager) IsDraining() bool {
+	return rm.draining.Load()
+}
+
+// StartDrain stops new room creation and tells every connected participant
+// the server is going away. Existing rooms keep running until they empty.
+// It returns false if the node was already draining.
+func (rm *RoomManager) StartDrain(reason string) bool {
+	if !rm.draining.CompareAndSwap(false, true) {
+		return false
+	}
+
+	rm.logger.Info().Str("reason", reason).Msg("draining, new rooms will be rejected")
+
+	content, _ := json.Marshal(map[string]string{"reason": reason})
+	message := core.Message{
+		Type:    "server_draining",
+		Action:  "drain",
+		Content: string(content),
+	}
+	for _, room := range rm.ListRooms() {
+		room.Broadcast("", message, rm.logger)
+	}
+
+	return true
+}
+
+// WaitForDrain blocks until no participants remain or ctx is done. Rooms that
+// empty while draining are closed by the reaper without waiting for their
+// empty timeout.
+func (rm *RoomManager) WaitForDrain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		remaining := rm.participantCount()
+		if remaining == 0 {
+			rm.logger.Info().Msg("drain complete, no participants remaining")
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			rm.logger.Warn().Int("participants", remaining).Msg("drain timed out with participants still connected")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (rm *RoomManager) participantCount() int {
+	count := 0
+	for _, room := range rm.ListRooms() {
+		count += room.GetParticipantCount()
+	}
+	return count
+}
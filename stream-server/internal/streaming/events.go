@@ -0,0 +1,312 @@
+package streaming
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type EventType string
+
+const (
+	EventRoomStarted       EventType = "room_started"
+	EventRoomFinished      EventType = "room_finished"
+	EventParticipantJoined EventType = "participant_joined"
+	EventParticipantLeft   EventType = "participant_left"
+	EventRoleChanged       EventType = "role_changed"
+	EventTrackPublished    EventType = "track_published"
+	EventTrackUnpublished  EventType = "track_unpublished"
+	// EventTracksSynced is emitted each time the room's peer connections were
+	// renegotiated with the current set of tracks.
+	EventTracksSynced EventType = "tracks_synced"
+	// EventRecordingFinished is reserved for the recorder; nothing in the SFU
+	// emits it yet.
+	EventRecordingFinished EventType = "recording_finished"
+)
+
+// Reasons reported by room_finished events besides the expiry reasons of the
+// reaper.
+const (
+	ReasonDeleted = "deleted"
+	// ReasonServerShutdown means the room was closed because this server is
+	// stopping, not because the room ended.
+	ReasonServerShutdown = "server_shutdown"
+)
+
+// Event describes a change in a room. Fields that do not apply to the event
+// type are left empty. Sequence increases by one for every event of a room, so
+// subscribers can detect events they dropped.
+type Event struct {
+	Type            EventType
+	RoomID          string
+	TenantID        string
+	Sequence        uint64
+	ParticipantID   string
+	ParticipantName string
+	Role            string
+	PreviousRole    string
+	TrackID         string
+	Kind            string
+	// Reason says why a room finished.
+	Reason    string
+	Timestamp time.Time
+}
+
+type EventHandler func(Event)
+
+// SubscribeOptions configure a subscription. A zero BufferSize uses
+// defaultEventBuffer; an empty Types list receives every event.
+type SubscribeOptions struct {
+	BufferSize int
+	Types      []EventType
+}
+
+const defaultEventBuffer = 1024
+
+// EventBus fans room events out to subscribers. Publishing never blocks: each
+// subscriber has its own bounded queue drained by its own goroutine, so events
+// reach a subscriber in publish order and a slow subscriber only loses its own
+// oldest events.
+type EventBus struct {
+	subscribers []*Subscription
+	sequences   map[string]uint64
+	closed      bool
+	mu          sync.Mutex
+	logger      *zerolog.Logger
+}
+
+type Subscription struct {
+	name    string
+	handler EventHandler
+	types   map[EventType]bool
+	queue   []Event
+	size    int
+	dropped uint64
+	closed  bool
+	wake    chan struct{}
+	done    chan struct{}
+	mu      sync.Mutex
+}
+
+func NewEventBus(logger *zerolog.Logger) *EventBus {
+	return &EventBus{
+		sequences: make(map[string]uint64),
+		logger:    logger,
+	}
+}
+
+// Subscribe registers handler under name. The handler runs on the
+// subscription's own goroutine and may block without affecting the room.
+func (b *EventBus) Subscribe(name string, handler EventHandler, opts SubscribeOptions) *Subscription {
+	size := opts.BufferSize
+	if size <= 0 {
+		size = defaultEventBuffer
+	}
+
+	s := &Subscription{
+		name:    name,
+		handler: handler,
+		size:    size,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if len(opts.Types) > 0 {
+		s.types = make(map[EventType]bool, len(opts.Types))
+		for _, t := range opts.Types {
+			s.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		s.closed = true
+		close(s.done)
+		return s
+	}
+	b.subscribers = append(b.subscribers, s)
+	b.mu.Unlock()
+
+	go s.run(b.logger)
+	return s
+}
+
+func (b *EventBus) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	for i, existing := range b.subscribers {
+		if existing == s {
+			b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+
+	s.close()
+	<-s.done
+}
+
+// Publish stamps the event with its room sequence and queues it for every
+// matching subscriber. The bus lock is held while queueing so all subscribers
+// see events in the same order.
+func (b *EventBus) Publish(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.sequences[event.RoomID]++
+	event.Sequence = b.sequences[event.RoomID]
+	if event.Type == EventRoomFinished {
+		delete(b.sequences, event.RoomID)
+	}
+
+	for _, s := range b.subscribers {
+		if s.types == nil || s.types[event.Type] {
+			s.push(event, b.logger)
+		}
+	}
+}
+
+// forget drops the sequence of a room that will publish no more events.
+func (b *EventBus) forget(roomID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.sequences, roomID)
+}
+
+// Close stops accepting events and waits until subscribers have drained their
+// queues or ctx is done.
+func (b *EventBus) Close(ctx context.Context) {
+	b.mu.Lock()
+	b.closed = true
+	subscribers := b.subscribers
+	b.subscribers = nil
+	b.mu.Unlock()
+
+	for _, s := range subscribers {
+		s.close()
+	}
+	for _, s := range subscribers {
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Subscription) push(event Event, logger *zerolog.Logger) {
+	s.mu.Lock()
+	if len(s.queue) >= s.size {
+		s.queue = s.queue[1:]
+		s.dropped++
+		if s.dropped == 1 || s.dropped%100 == 0 {
+			logger.Warn().Str("subscriber", s.name).Uint64("dropped", s.dropped).Msg("event subscriber is falling behind, dropping oldest events")
+		}
+	}
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) run(logger *zerolog.Logger) {
+	defer close(s.done)
+
+	for range s.wake {
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				closed := s.closed
+				s.mu.Unlock()
+				if closed {
+					return
+				}
+				break
+			}
+			event := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			s.deliver(event, logger)
+		}
+	}
+}
+
+func (s *Subscription) deliver(event Event, logger *zerolog.Logger) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error().Str("subscriber", s.name).Str("event", string(event.Type)).Interface("panic", r).Msg("event subscriber panicked")
+		}
+	}()
+	s.handler(event)
+}
+
+// Dropped returns how many events were discarded because the subscriber's
+// queue was full.
+func (s *Subscription) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (rm *RoomManager) Events() *EventBus {
+	return rm.events
+}
+
+// emit fills in the room fields and publishes the event. Nothing is published
+// after the room finished, so the room's sequence is not started again.
+func (r *Room) emit(event Event) {
+	if r.events == nil {
+		return
+	}
+
+	r.emitMu.Lock()
+	defer r.emitMu.Unlock()
+
+	if r.finished {
+		return
+	}
+	if event.Type == EventRoomFinished {
+		r.finished = true
+	}
+	event.RoomID = r.ID
+	event.TenantID = r.TenantID
+	r.events.Publish(event)
+}
+
+// finish stops publishing the events of a room that ends without a
+// room_finished event, like the edge copy of a room.
+func (r *Room) finish() {
+	if r.events == nil {
+		return
+	}
+
+	r.emitMu.Lock()
+	defer r.emitMu.Unlock()
+
+	r.finished = true
+	r.events.forget(r.ID)
+}
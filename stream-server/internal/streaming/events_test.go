@@ -0,0 +1,28 @@
+package streaming
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestNoEventsAfterRoomFinished(t *testing.T) {
+	logger := zerolog.Nop()
+	bus := NewEventBus(&logger)
+	var events []Event
+	bus.Subscribe("test", func(e Event) { events = append(events, e) }, SubscribeOptions{})
+
+	room := &Room{ID: "room-1", TenantID: DefaultTenantID, events: bus}
+	room.emit(Event{Type: EventRoomStarted})
+	room.emit(Event{Type: EventRoomFinished, Reason: ReasonDeleted})
+	room.emit(Event{Type: EventTrackUnpublished, TrackID: "track-1"})
+	bus.Close(context.Background())
+
+	if len(events) != 2 || events[1].Type != EventRoomFinished || events[1].Sequence != 2 {
+		t.Fatalf("events = %+v, want room_started and room_finished", events)
+	}
+	if len(bus.sequences) != 0 {
+		t.Errorf("sequences = %v, want the finished room forgotten", bus.sequences)
+	}
+}
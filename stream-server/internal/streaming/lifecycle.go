@@ -0,0 +1,265 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"stream-server/internal/core"
+
+	"github.com/rs/zerolog"
+)
+
+type RoomPolicy struct {
+	// EmptyTimeout closes the room once it has had no participants for this
+	// long. Nil takes the default; zero never closes an empty room.
+	EmptyTimeout *time.Duration
+	// MaxDuration closes the room this long after it was created.
+	MaxDuration    time.Duration
+	ScheduledStart time.Time
+	ScheduledEnd   time.Time
+	// ClosingWarning is how long before a forced shutdown participants receive
+	// a room_closing message.
+	ClosingWarning time.Duration
+	// Lobby holds non-host participants until the host admits them.
+	Lobby bool
+	// Access is only read at room creation; the passcode is stored hashed.
+	Access AccessPolicy
+	// RoleCapacity limits how many participants may hold each role at once.
+	// Roles that are absent or zero are unlimited.
+	RoleCapacity map[string]int
+	// RolePermissions overrides core.RoleTemplates for this room.
+	RolePermissions map[string]core.Permissions
+}
+
+func DefaultRoomPolicy() RoomPolicy {
+	emptyTimeout := 5 * time.Minute
+	return RoomPolicy{
+		EmptyTimeout:   &emptyTimeout,
+		ClosingWarning: time.Minute,
+		RoleCapacity: map[string]int{
+			core.RoleHost:  1,
+			core.RoleGuest: 1,
+		},
+	}
+}
+
+// Merge fills zero-valued fields of p from defaults, and EmptyTimeout if it is
+// nil.
+func (p RoomPolicy) Merge(defaults RoomPolicy) RoomPolicy {
+	if p.EmptyTimeout == nil {
+		p.EmptyTimeout = defaults.EmptyTimeout
+	}
+	if p.MaxDuration == 0 {
+		p.MaxDuration = defaults.MaxDuration
+	}
+	if p.ScheduledStart.IsZero() {
+		p.ScheduledStart = defaults.ScheduledStart
+	}
+	if p.ScheduledEnd.IsZero() {
+		p.ScheduledEnd = defaults.ScheduledEnd
+	}
+	if p.ClosingWarning == 0 {
+		p.ClosingWarning = defaults.ClosingWarning
+	}
+	p.Lobby = p.Lobby || defaults.Lobby
+	p.RoleCapacity = mergeRoleMap(p.RoleCapacity, defaults.RoleCapacity)
+	p.RolePermissions = mergeRoleMap(p.RolePermissions, defaults.RolePermissions)
+	return p
+}
+
+// EmptyTimeoutDuration returns EmptyTimeout, or zero if it is not set.
+func (p RoomPolicy) EmptyTimeoutDuration() time.Duration {
+	if p.EmptyTimeout == nil {
+		return 0
+	}
+	return *p.EmptyTimeout
+}
+
+// mergeRoleMap returns a copy of values with any role missing from it taken
+// from defaults.
+func mergeRoleMap[V any](values map[string]V, defaults map[string]V) map[string]V {
+	merged := make(map[string]V, len(values)+len(defaults))
+	for role, value := range defaults {
+		merged[role] = value
+	}
+	for role, value := range values {
+		merged[role] = value
+	}
+	return merged
+}
+
+func (p RoomPolicy) Validate() error {
+	if p.EmptyTimeoutDuration() < 0 || p.MaxDuration < 0 || p.ClosingWarning < 0 {
+		return fmt.Errorf("room policy durations must not be negative")
+	}
+	if !p.ScheduledStart.IsZero() && !p.ScheduledEnd.IsZero() && !p.ScheduledEnd.After(p.ScheduledStart) {
+		return fmt.Errorf("scheduled end must be after scheduled start")
+	}
+	for role, capacity := range p.RoleCapacity {
+		if !core.IsValidRole(role) {
+			return fmt.Errorf("unknown role %q in role capacity", role)
+		}
+		if capacity < 0 {
+			return fmt.Errorf("capacity for role %q must not be negative", role)
+		}
+	}
+	for role := range p.RolePermissions {
+		if !core.IsValidRole(role) {
+			return fmt.Errorf("unknown role %q in role permissions", role)
+		}
+	}
+	return nil
+}
+
+// closesAtLocked returns the earliest forced shutdown time for the room, or the
+// zero time if the room has no hard deadline. The caller must hold r.mu.
+func (r *Room) closesAtLocked() time.Time {
+	var closesAt time.Time
+	if r.Policy.MaxDuration > 0 {
+		closesAt = r.CreatedAt.Add(r.Policy.MaxDuration)
+	}
+	if !r.Policy.ScheduledEnd.IsZero() && (closesAt.IsZero() || r.Policy.ScheduledEnd.Before(closesAt)) {
+		closesAt = r.Policy.ScheduledEnd
+	}
+	return closesAt
+}
+
+func (r *Room) ClosesAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.closesAtLocked()
+}
+
+func (r *Room) GetPolicy() RoomPolicy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Policy
+}
+
+// UpdatePolicy replaces the room policy. A new deadline re-arms the
+// room_closing warning.
+func (r *Room) UpdatePolicy(policy RoomPolicy) {
+	defer r.relayRoomUpdated()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.closesAtLocked()
+	r.Policy = policy
+	if !r.closesAtLocked().Equal(previous) {
+		r.closingNotified = false
+	}
+	if !policy.Lobby {
+		r.admitAllLocked()
+	}
+}
+
+func (r *Room) HasStarted(now time.Time) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Policy.ScheduledStart.IsZero() || !now.Before(r.Policy.ScheduledStart)
+}
+
+// StartReaper periodically closes rooms whose policy has expired until ctx is
+// cancelled.
+func (rm *RoomManager) StartReaper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		rm.logger.Info().Dur("interval", interval).Msg("room reaper started")
+		for {
+			select {
+			case <-ctx.Done():
+				rm.logger.Info().Msg("room reaper stopped")
+				return
+			case now := <-ticker.C:
+				rm.reapRooms(now)
+			}
+		}
+	}()
+}
+
+func (rm *RoomManager) reapRooms(now time.Time) {
+	rm.mu.RLock()
+	rooms := make([]*Room, 0, len(rm.Rooms))
+	for _, room := range rm.Rooms {
+		rooms = append(rooms, room)
+	}
+	rm.mu.RUnlock()
+
+	draining := rm.IsDraining()
+	for _, room := range rooms {
+		if draining && room.GetParticipantCount() == 0 {
+			rm.logger.Info().Str("room_id", room.ID).Msg("closing empty room while draining")
+			rm.deleteRoom(room.ID, ReasonServerShutdown)
+			continue
+		}
+		if reason, expired := room.checkExpiry(now, rm.logger); expired {
+			rm.logger.Info().Str("room_id", room.ID).Str("reason", reason).Msg("closing expired room")
+			rm.deleteRoom(room.ID, reason)
+		}
+	}
+}
+
+// checkExpiry reports whether the room should be closed and sends the
+// room_closing warning once the room enters its warning window.
+func (r *Room) checkExpiry(now time.Time, logger *zerolog.Logger) (string, bool) {
+	r.mu.Lock()
+
+	if emptyTimeout := r.Policy.EmptyTimeoutDuration(); len(r.Participants) == 0 && emptyTimeout > 0 {
+		emptySince := r.emptySince
+		if !r.Policy.ScheduledStart.IsZero() && emptySince.Before(r.Policy.ScheduledStart) {
+			emptySince = r.Policy.ScheduledStart
+		}
+		if now.Sub(emptySince) >= emptyTimeout {
+			r.mu.Unlock()
+			return "empty_timeout", true
+		}
+	}
+
+	closesAt := r.closesAtLocked()
+	if closesAt.IsZero() {
+		r.mu.Unlock()
+		return "", false
+	}
+
+	if !now.Before(closesAt) {
+		r.mu.Unlock()
+		return "deadline_reached", true
+	}
+
+	notify := !r.closingNotified && now.Add(r.Policy.ClosingWarning).After(closesAt)
+	if notify {
+		r.closingNotified = true
+	}
+	r.mu.Unlock()
+
+	if notify {
+		closingMsg := core.Message{
+			Type:    "room_closing",
+			Action:  "close",
+			Content: fmt.Sprintf(`{"room_id":"%s","closes_at":%d,"seconds_remaining":%d}`, r.ID, closesAt.Unix(), int(closesAt.Sub(now).Seconds())),
+		}
+		logger.Info().Str("room_id", r.ID).Time("closes_at", closesAt).Msg("notifying participants of room closing")
+		r.Broadcast("", closingMsg, logger)
+	}
+
+	return "", false
+}
+
+// sendRoomClosed tells the participant why the room is closing. It writes to
+// the connection directly because the send channel is closed along with it.
+func (r *Room) sendRoomClosed(p *Participant, reason string, logger *zerolog.Logger) {
+	data, _ := json.Marshal(core.Message{
+		Type:    "room_closed",
+		To:      p.ID,
+		Action:  "close",
+		Content: fmt.Sprintf(`{"room_id":"%s","reason":"%s"}`, r.ID, reason),
+	})
+	if err := p.Conn.Send(data); err != nil {
+		logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("failed to send room_closed")
+	}
+}
@@ -0,0 +1,86 @@
+package streaming
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"stream-server/internal/core"
+	"stream-server/internal/rtc"
+
+	"github.com/rs/zerolog"
+)
+
+func TestZeroEmptyTimeoutKeepsRoomOpen(t *testing.T) {
+	disabled := time.Duration(0)
+	tests := []struct {
+		name      string
+		policy    RoomPolicy
+		wantClose bool
+	}{
+		{"default", RoomPolicy{}, true},
+		{"disabled", RoomPolicy{EmptyTimeout: &disabled}, false},
+	}
+
+	logger := zerolog.Nop()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			room := &Room{Policy: tt.policy.Merge(DefaultRoomPolicy()), emptySince: time.Now()}
+			if _, closed := room.checkExpiry(time.Now().Add(time.Hour), &logger); closed != tt.wantClose {
+				t.Errorf("closed = %v after an hour empty, want %v", closed, tt.wantClose)
+			}
+		})
+	}
+}
+
+// recordingConn keeps what is sent to it.
+type recordingConn struct {
+	scriptConn
+	sent [][]byte
+	mu   sync.Mutex
+}
+
+func (c *recordingConn) Send(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, data)
+	return nil
+}
+
+func TestDeletedRoomNotifiesParticipants(t *testing.T) {
+	logger := zerolog.Nop()
+	rm := NewRoomManager(&logger, rtc.DefaultConfig(), DefaultRoomPolicy())
+	t.Cleanup(rm.CloseAllRooms)
+	room, _, err := rm.CreateRoom("room-1", "Room", "host", DefaultTenantID, RoomPolicy{})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	conn := &recordingConn{scriptConn: scriptConn{msgs: make(chan []byte)}}
+	p := &Participant{
+		ID:          "alice",
+		Role:        core.RoleGuest,
+		Permissions: room.PermissionsForRole(core.RoleGuest),
+		Conn:        conn,
+		Room:        room,
+		SendChan:    make(chan core.Message, 16),
+		JoinedAt:    time.Now(),
+	}
+	if err := room.AddParticipant(p, &logger); err != nil {
+		t.Fatalf("AddParticipant: %v", err)
+	}
+
+	rm.DeleteRoom(room.ID)
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if len(conn.sent) != 1 {
+		t.Fatalf("participant got %d messages, want room_closed", len(conn.sent))
+	}
+	var msg core.Message
+	if err := json.Unmarshal(conn.sent[0], &msg); err != nil || msg.Type != "room_closed" || !strings.Contains(msg.Content, `"reason":"deleted"`) {
+		t.Errorf("participant got %s, want room_closed with the reason", conn.sent[0])
+	}
+}
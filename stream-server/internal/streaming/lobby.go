@@ -0,0 +1,224 @@
+package streaming
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"stream-server/internal/core"
+	"stream-server/internal/metrics"
+
+	"github.com/rs/zerolog"
+)
+
+const lobbyWaitTimeout = 10 * time.Minute
+
+var errConnectionClosed = errors.New("connection closed")
+
+type lobbyEntry struct {
+	participant *Participant
+	decision    chan bool
+}
+
+// pumpedConnection reads from the underlying connection on its own goroutine so
+// a participant waiting in the lobby can be dropped as soon as the client
+// disconnects. Once admitted, ReadPump keeps reading through it.
+type pumpedConnection struct {
+	core.Connection
+	msgs     chan []byte
+	done     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	err      error
+}
+
+func newPumpedConnection(conn core.Connection) *pumpedConnection {
+	c := &pumpedConnection{
+		Connection: conn,
+		msgs:       make(chan []byte, 64),
+		done:       make(chan struct{}),
+		stop:       make(chan struct{}),
+	}
+
+	go func() {
+		defer close(c.msgs)
+		defer close(c.done)
+		for {
+			msg, err := conn.Read()
+			if err != nil {
+				c.err = err
+				return
+			}
+			select {
+			case c.msgs <- msg:
+			case <-c.stop:
+				c.err = errConnectionClosed
+				return
+			}
+		}
+	}()
+
+	return c
+}
+
+func (c *pumpedConnection) Read() ([]byte, error) {
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			return nil, c.err
+		}
+		return msg, nil
+	case <-c.stop:
+		return nil, errConnectionClosed
+	}
+}
+
+func (c *pumpedConnection) Close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.Connection.Close()
+}
+
+func (c *pumpedConnection) closed() <-chan struct{} {
+	return c.done
+}
+
+func lobbyContent(p *Participant) string {
+	content, _ := json.Marshal(map[string]string{
+		"participant_id":   p.ID,
+		"participant_name": p.Name,
+		"participant_role": p.Role,
+	})
+	return string(content)
+}
+
+func lobbyRequestMessage(p *Participant) core.Message {
+	return core.Message{
+		Type:    "lobby_request",
+		From:    p.ID,
+		Name:    p.Name,
+		Role:    p.Role,
+		Action:  "lobby",
+		Content: lobbyContent(p),
+	}
+}
+
+// RequiresAdmission reports whether p has to wait in the lobby before joining.
+func (r *Room) RequiresAdmission(p *Participant) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Policy.Lobby && p.Role != "host"
+}
+
+// WaitInLobby parks p until the host admits or rejects them, the client
+// disconnects, or the wait times out. It reports whether p was admitted.
+func (r *Room) WaitInLobby(p *Participant, logger *zerolog.Logger) (bool, error) {
+	conn := newPumpedConnection(p.Conn)
+	p.Conn = conn
+
+	entry := &lobbyEntry{
+		participant: p,
+		decision:    make(chan bool, 1),
+	}
+
+	r.mu.Lock()
+	if _, waiting := r.lobby[p.ID]; waiting {
+		r.mu.Unlock()
+		return false, fmt.Errorf("participant %s is already waiting in the lobby", p.ID)
+	}
+	r.lobby[p.ID] = entry
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		if r.lobby[p.ID] == entry {
+			delete(r.lobby, p.ID)
+		}
+		r.mu.Unlock()
+	}()
+
+	logger.Info().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("participant waiting in lobby")
+	r.notifyHost(p.ID, lobbyRequestMessage(p), logger)
+
+	waitingMsg, _ := json.Marshal(core.Message{
+		Type:    "lobby_waiting",
+		To:      p.ID,
+		Content: lobbyContent(p),
+	})
+	if err := p.Conn.Send(waitingMsg); err != nil {
+		return false, err
+	}
+
+	select {
+	case admitted := <-entry.decision:
+		if !admitted {
+			rejectedMsg, _ := json.Marshal(core.Message{
+				Type:    "lobby_rejected",
+				To:      p.ID,
+				Content: lobbyContent(p),
+			})
+			_ = p.Conn.Send(rejectedMsg)
+		}
+		logger.Info().Str("room_id", r.ID).Str("participant_id", p.ID).Bool("admitted", admitted).Msg("lobby decision received")
+		return admitted, nil
+
+	case <-time.After(lobbyWaitTimeout):
+		logger.Info().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("lobby wait timed out")
+		r.notifyHost(p.ID, core.Message{Type: "lobby_left", From: p.ID, Content: lobbyContent(p)}, logger)
+		return false, fmt.Errorf("timed out waiting for admission")
+
+	case <-conn.closed():
+		logger.Info().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("participant left the lobby")
+		r.notifyHost(p.ID, core.Message{Type: "lobby_left", From: p.ID, Content: lobbyContent(p)}, logger)
+		return false, fmt.Errorf("connection closed while waiting in lobby")
+	}
+}
+
+func (r *Room) decideLobby(participantID string, admitted bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.lobby[participantID]
+	if !ok {
+		return fmt.Errorf("participant %s is not waiting in the lobby", participantID)
+	}
+	delete(r.lobby, participantID)
+
+	entry.decision <- admitted
+	return nil
+}
+
+func (r *Room) AdmitFromLobby(participantID string) error {
+	return r.decideLobby(participantID, true)
+}
+
+func (r *Room) RejectFromLobby(participantID string) error {
+	return r.decideLobby(participantID, false)
+}
+
+// admitAllLocked lets everyone waiting in the lobby in. The caller must hold
+// r.mu.
+func (r *Room) admitAllLocked() {
+	r.decideAllLocked(true)
+}
+
+func (r *Room) decideAllLocked(admitted bool) {
+	for id, entry := range r.lobby {
+		delete(r.lobby, id)
+		entry.decision <- admitted
+	}
+}
+
+// sendLobbyRequestsLocked replays pending lobby requests to a host that has
+// just joined. The caller must hold r.mu.
+func (r *Room) sendLobbyRequestsLocked(host *Participant, logger *zerolog.Logger) {
+	for _, entry := range r.lobby {
+		select {
+		case host.SendChan <- lobbyRequestMessage(entry.participant):
+		default:
+			metrics.SignalingMessagesDropped.WithLabelValues("lobby").Inc()
+			logger.Warn().Str("room_id", r.ID).Str("participant_id", entry.participant.ID).Msg("dropping lobby request, send channel full")
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package streaming
+
+import (
+	"stream-server/internal/core"
+	"stream-server/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	roomsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "", "rooms"),
+		"Open rooms.", nil, nil)
+	participantsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "", "participants"),
+		"Connected participants by role.", []string{"role"}, nil)
+	publishedTracksDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "", "published_tracks"),
+		"Tracks being forwarded by kind.", []string{"kind"}, nil)
+	peerConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "", "peer_connections"),
+		"Peer connections by connection state.", []string{"state"}, nil)
+)
+
+// roomCollector reads room gauges at scrape time so they cannot drift from
+// the room state.
+type roomCollector struct {
+	rm *RoomManager
+}
+
+// MetricsCollector returns a collector for room, participant, track and peer
+// connection gauges.
+func (rm *RoomManager) MetricsCollector() prometheus.Collector {
+	return roomCollector{rm: rm}
+}
+
+func (c roomCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- roomsDesc
+	ch <- participantsDesc
+	ch <- publishedTracksDesc
+	ch <- peerConnectionsDesc
+}
+
+func (c roomCollector) Collect(ch chan<- prometheus.Metric) {
+	rooms := c.rm.ListRooms()
+
+	participants := make(map[string]int)
+	tracks := make(map[string]int)
+	peerConnections := make(map[string]int)
+
+	for _, room := range rooms {
+		room.mu.RLock()
+		for _, p := range room.Participants {
+			participants[p.Role]++
+			if p.rtcConn == nil {
+				continue
+			}
+			if pc := p.rtcConn.GetPeerConnection(); pc != nil {
+				peerConnections[pc.ConnectionState().String()]++
+			}
+		}
+		for _, meta := range room.trackMeta {
+			tracks[meta.Kind]++
+		}
+		room.mu.RUnlock()
+	}
+
+	ch <- prometheus.MustNewConstMetric(roomsDesc, prometheus.GaugeValue, float64(len(rooms)))
+	// Report every known role so empty roles read as zero instead of missing.
+	for role := range core.RoleTemplates {
+		participants[role] += 0
+	}
+	for role, count := range participants {
+		ch <- prometheus.MustNewConstMetric(participantsDesc, prometheus.GaugeValue, float64(count), role)
+	}
+	for kind, count := range tracks {
+		ch <- prometheus.MustNewConstMetric(publishedTracksDesc, prometheus.GaugeValue, float64(count), kind)
+	}
+	for state, count := range peerConnections {
+		ch <- prometheus.MustNewConstMetric(peerConnectionsDesc, prometheus.GaugeValue, float64(count), state)
+	}
+}
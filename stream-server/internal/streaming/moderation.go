@@ -0,0 +1,277 @@
+package streaming
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"stream-server/internal/core"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrNotHost = errors.New("only the host can moderate the room")
+	// ErrParticipantConnected is returned when a connection would replace a
+	// participant that holds another role.
+	ErrParticipantConnected = errors.New("participant is already connected with another role")
+)
+
+// IsHost reports whether userID is the host's user id. CheckAccess reserves it
+// for joins that present the host key.
+func (r *Room) IsHost(userID string) bool {
+	return userID != "" && userID == r.CreatedBy
+}
+
+func (r *Room) IsBanned(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.bannedUsers[userID]
+}
+
+// KickParticipant tells the participant why they are being removed and then
+// drops them from the room. Participants connected to another node of the
+// room are kicked there.
+func (r *Room) KickParticipant(participantID string, reason string, logger *zerolog.Logger) error {
+	return r.kickParticipant(participantID, reason, nil, logger)
+}
+
+// kickParticipant does not pass the kick back to from, the link it arrived on.
+func (r *Room) kickParticipant(participantID string, reason string, from *relayLink, logger *zerolog.Logger) error {
+	if r.IsHost(participantID) {
+		return fmt.Errorf("the host cannot be removed from the room")
+	}
+
+	r.mu.RLock()
+	p, ok := r.Participants[participantID]
+	isHost := ok && p.Role == core.RoleHost
+	r.mu.RUnlock()
+	if !ok {
+		if link := r.relayLinkOf(participantID, from); link != nil {
+			link.sendControl(relayMessage{Type: relayKick, ParticipantID: participantID, Reason: reason})
+			return nil
+		}
+		return fmt.Errorf("participant %s does not exist", participantID)
+	}
+	if isHost {
+		return fmt.Errorf("the host cannot be removed from the room")
+	}
+
+	content, _ := json.Marshal(map[string]string{
+		"room_id": r.ID,
+		"reason":  reason,
+	})
+	data, _ := json.Marshal(core.Message{
+		Type:    "kicked",
+		To:      p.ID,
+		Action:  "kick",
+		Content: string(content),
+	})
+	if err := p.Conn.Send(data); err != nil {
+		logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("failed to deliver kick reason")
+	}
+
+	logger.Info().Str("room_id", r.ID).Str("participant_id", p.ID).Str("reason", reason).Msg("kicking participant")
+	r.RemoveParticipant(p, logger)
+	return nil
+}
+
+// BanUser prevents userID from rejoining the room on any node and kicks them
+// if they are currently connected.
+func (r *Room) BanUser(userID string, reason string, logger *zerolog.Logger) error {
+	return r.banUser(userID, reason, nil, logger)
+}
+
+func (r *Room) banUser(userID string, reason string, from *relayLink, logger *zerolog.Logger) error {
+	if r.IsHost(userID) {
+		return fmt.Errorf("the host cannot be banned from the room")
+	}
+
+	r.mu.Lock()
+	p, connected := r.Participants[userID]
+	if connected && p.Role == core.RoleHost {
+		r.mu.Unlock()
+		return fmt.Errorf("the host cannot be banned from the room")
+	}
+	r.bannedUsers[userID] = true
+	r.mu.Unlock()
+	r.persistChanges()
+
+	logger.Info().Str("room_id", r.ID).Str("user_id", userID).Str("reason", reason).Msg("user banned from room")
+
+	for _, l := range r.relayLinks() {
+		if l != from {
+			l.sendControl(relayMessage{Type: relayBan, ParticipantID: userID, Reason: reason})
+		}
+	}
+
+	if connected {
+		return r.kickParticipant(userID, reason, from, logger)
+	}
+	return nil
+}
+
+// ReplaceParticipant disconnects the participant connected as userID so that a
+// reconnect with the same role can take its place. A connection with another
+// role cannot take over the participant.
+func (r *Room) ReplaceParticipant(userID string, role string, logger *zerolog.Logger) error {
+	r.mu.RLock()
+	existing, ok := r.Participants[userID]
+	if ok && existing.Role != role {
+		r.mu.RUnlock()
+		return ErrParticipantConnected
+	}
+	r.mu.RUnlock()
+
+	if ok {
+		logger.Info().Str("room_id", r.ID).Str("participant_id", userID).Msg("replacing the participant's previous connection")
+		r.RemoveParticipant(existing, logger)
+	}
+	return nil
+}
+
+// ChangeRole moves a participant between the guest and audience roles. A
+// participant that loses the publish permission has its tracks unpublished but
+// keeps receiving the room's tracks; one left without media permissions loses
+// its peer connection. Participants connected to another node of the room are
+// changed there.
+func (r *Room) ChangeRole(participantID string, role string, logger *zerolog.Logger) error {
+	return r.changeRole(participantID, role, nil, logger)
+}
+
+func (r *Room) changeRole(participantID string, role string, from *relayLink, logger *zerolog.Logger) error {
+	if role != core.RoleGuest && role != core.RoleAudience {
+		return fmt.Errorf("invalid role %q, expected guest or audience", role)
+	}
+
+	r.mu.Lock()
+	p, ok := r.Participants[participantID]
+	if !ok {
+		r.mu.Unlock()
+		if link := r.relayLinkOf(participantID, from); link != nil {
+			link.sendControl(relayMessage{Type: relayChangeRole, ParticipantID: participantID, Role: role})
+			return nil
+		}
+		return fmt.Errorf("participant %s does not exist", participantID)
+	}
+
+	if p.Role != core.RoleGuest && p.Role != core.RoleAudience {
+		r.mu.Unlock()
+		return fmt.Errorf("cannot change role of participant with role %q", p.Role)
+	}
+
+	if p.Role != role {
+		if err := r.checkRoleCapacityLocked(role, p.ID); err != nil {
+			r.mu.Unlock()
+			return err
+		}
+	}
+
+	previousRole := p.Role
+	p.Role = role
+	p.Permissions = r.permissionsForRoleLocked(role)
+	r.roles[p.ID] = role
+
+	var rtcConn, unpublish core.RTCConnection
+	switch {
+	case !p.Permissions.UsesPeerConnection():
+		rtcConn = p.rtcConn
+		p.rtcConn = nil
+	case !p.Permissions.CanPublish:
+		unpublish = p.rtcConn
+	}
+	if role == core.RoleAudience {
+		p.onStage = false
+	}
+	r.mu.Unlock()
+
+	if rtcConn != nil {
+		p.resetNegotiation()
+		_ = rtcConn.Close(logger)
+	}
+	if unpublish != nil {
+		// Ending the received tracks stops their forwarding, which removes
+		// them from the room and renegotiates the subscribers.
+		stopPublishing(unpublish)
+	}
+
+	r.syncRelayParticipants(nil)
+
+	logger.Info().Str("room_id", r.ID).Str("participant_id", p.ID).Str("previous_role", previousRole).Str("role", role).Msg("participant role changed")
+	r.emit(Event{Type: EventRoleChanged, ParticipantID: p.ID, ParticipantName: p.Name, Role: role, PreviousRole: previousRole})
+
+	content, _ := json.Marshal(map[string]string{
+		"participant_id":   p.ID,
+		"participant_name": p.Name,
+		"previous_role":    previousRole,
+		"role":             role,
+	})
+	r.Broadcast("", core.Message{
+		Type:    "role_changed",
+		From:    p.ID,
+		Role:    role,
+		Action:  "role_change",
+		Content: string(content),
+	}, logger)
+
+	if rtcConn != nil {
+		r.SignalPeerConnections(logger)
+	}
+
+	return nil
+}
+
+// stopPublishing ends the tracks received from a participant's peer connection
+// and leaves the tracks sent to it alone.
+func stopPublishing(rtcConn core.RTCConnection) {
+	peerConnection := rtcConn.GetPeerConnection()
+	if peerConnection == nil {
+		return
+	}
+	for _, receiver := range peerConnection.GetReceivers() {
+		if receiver.Track() != nil {
+			_ = receiver.Stop()
+		}
+	}
+}
+
+func (p *Participant) handleModeration(r *Room, msg core.Message, logger *zerolog.Logger) {
+	if _, permissions := p.access(); !permissions.CanModerate {
+		logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Str("type", msg.Type).Msg("participant without moderation permission attempted a moderation action")
+		p.Room.SendBack(p.ID, core.Message{
+			Type:    "error",
+			To:      p.ID,
+			Content: ErrNotHost.Error(),
+		}, logger)
+		return
+	}
+
+	var err error
+	switch msg.Type {
+	case "kick":
+		err = r.KickParticipant(msg.To, msg.Content, logger)
+	case "ban":
+		err = r.BanUser(msg.To, msg.Content, logger)
+	case "change_role":
+		err = r.ChangeRole(msg.To, msg.Role, logger)
+	case "approve_stage":
+		err = r.ApproveStage(msg.To, logger)
+	case "deny_stage":
+		err = r.DenyStage(msg.To, logger)
+	case "remove_from_stage":
+		err = r.LeaveStage(msg.To, logger)
+	case "admit":
+		err = r.AdmitFromLobby(msg.To)
+	case "reject":
+		err = r.RejectFromLobby(msg.To)
+	}
+
+	if err != nil {
+		logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Str("target_id", msg.To).Err(err).Msg("moderation action failed")
+		p.Room.SendBack(p.ID, core.Message{
+			Type:    "error",
+			To:      p.ID,
+			Content: fmt.Sprintf("Failed to %s participant: %v", msg.Type, err),
+		}, logger)
+	}
+}
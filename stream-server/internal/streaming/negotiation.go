@@ -0,0 +1,319 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"stream-server/internal/core"
+	"stream-server/internal/metrics"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog"
+)
+
+// The server always acts as the polite peer: when a client offer collides with
+// an offer the server has in flight, the server rolls its own offer back, answers
+// the client and re-offers once the connection is stable again.
+
+const (
+	negotiationAnswerTimeout = 10 * time.Second
+	// maxNegotiationFailures is how many offers in a row may fail before the
+	// server stops retrying and tells the client.
+	maxNegotiationFailures = 5
+)
+
+type negotiationState int
+
+const (
+	negotiationStable negotiationState = iota
+	negotiationAwaitingAnswer
+	negotiationAnsweringOffer
+)
+
+func (s negotiationState) String() string {
+	switch s {
+	case negotiationStable:
+		return "stable"
+	case negotiationAwaitingAnswer:
+		return "awaiting-answer"
+	case negotiationAnsweringOffer:
+		return "answering-offer"
+	default:
+		return "unknown"
+	}
+}
+
+type negotiator struct {
+	state        negotiationState
+	pending      bool
+	failures     int
+	answerTimer  *time.Timer
+	offerCounter uint64
+	mu           sync.Mutex
+}
+
+// negotiateLocked brings the participant's senders in line with the room's
+// tracks and sends a fresh offer, or queues the change if a negotiation is
+// already in progress. The caller must hold r.mu.
+func (r *Room) negotiateLocked(p *Participant, outgoingTracks []core.OutgoingTrackMetaData, logger *zerolog.Logger) {
+	if !p.Permissions.UsesPeerConnection() || p.rtcConn == nil {
+		return
+	}
+
+	peerConnection := p.rtcConn.GetPeerConnection()
+	if peerConnection == nil {
+		return
+	}
+
+	if peerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed ||
+		peerConnection.ConnectionState() == webrtc.PeerConnectionStateFailed {
+		logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Str("pc_state", peerConnection.ConnectionState().String()).Msg("skipping negotiation for closed peer connection")
+		return
+	}
+
+	p.negotiation.mu.Lock()
+	defer p.negotiation.mu.Unlock()
+
+	if p.negotiation.state != negotiationStable || peerConnection.SignalingState() != webrtc.SignalingStateStable {
+		logger.Debug().
+			Str("room_id", r.ID).
+			Str("participant_id", p.ID).
+			Str("negotiation_state", p.negotiation.state.String()).
+			Str("signaling_state", peerConnection.SignalingState().String()).
+			Msg("negotiation in progress, queueing change")
+		p.negotiation.pending = true
+		return
+	}
+
+	if err := r.syncSendersLocked(p, peerConnection, logger); err != nil {
+		r.retryNegotiationLocked(p, fmt.Errorf("sync senders: %w", err), logger)
+		return
+	}
+
+	offer, err := peerConnection.CreateOffer(nil)
+	if err != nil {
+		r.retryNegotiationLocked(p, fmt.Errorf("create offer: %w", err), logger)
+		return
+	}
+
+	if err := peerConnection.SetLocalDescription(offer); err != nil {
+		r.retryNegotiationLocked(p, fmt.Errorf("set local description: %w", err), logger)
+		return
+	}
+
+	p.negotiation.state = negotiationAwaitingAnswer
+	p.negotiation.pending = false
+	p.negotiation.failures = 0
+	p.negotiation.offerCounter++
+	p.armAnswerTimeoutLocked(p.negotiation.offerCounter, logger)
+
+	offerMessage := core.Message{
+		Type:           "sdp",
+		SDP:            &offer,
+		OutgoingTracks: outgoingTracks,
+	}
+
+	if err := r.sendBackLocked(p.ID, offerMessage, logger); err != nil {
+		logger.Warn().Err(err).Str("room_id", r.ID).Str("participant_id", p.ID).Msg("failed to deliver offer, waiting for answer timeout")
+	}
+}
+
+// retryNegotiationLocked handles an offer that failed while the connection was
+// stable. Nothing else would trigger another round, so a sync is scheduled
+// until too many attempts have failed. The caller must hold r.mu and the
+// negotiation lock.
+func (r *Room) retryNegotiationLocked(p *Participant, err error, logger *zerolog.Logger) {
+	metrics.NegotiationRetries.WithLabelValues("offer_error").Inc()
+	p.negotiation.pending = false
+	p.negotiation.failures++
+
+	if p.negotiation.failures > maxNegotiationFailures {
+		p.negotiation.failures = 0
+		logger.Error().Err(err).Str("room_id", r.ID).Str("participant_id", p.ID).Msg("failed to renegotiate, giving up")
+		_ = r.sendBackLocked(p.ID, core.Message{
+			Type:    "error",
+			To:      p.ID,
+			Content: fmt.Sprintf("Failed to renegotiate: %v", err),
+		}, logger)
+		return
+	}
+
+	logger.Error().Err(err).Str("room_id", r.ID).Str("participant_id", p.ID).Int("attempt", p.negotiation.failures).Msg("failed to renegotiate, scheduling retry")
+	r.scheduleSyncLocked(logger)
+}
+
+func (r *Room) syncSendersLocked(p *Participant, peerConnection *webrtc.PeerConnection, logger *zerolog.Logger) error {
+	existingSender := map[string]bool{}
+
+	for _, sender := range peerConnection.GetSenders() {
+		if sender.Track() == nil {
+			continue
+		}
+		existingSender[sender.Track().ID()] = true
+
+		if _, ok := r.trackLocals[sender.Track().ID()]; !ok {
+			logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Str("track_id", sender.Track().ID()).Msg("removing stale track")
+			if err := peerConnection.RemoveTrack(sender); err != nil {
+				return fmt.Errorf("remove track %s: %w", sender.Track().ID(), err)
+			}
+		}
+	}
+
+	for _, receiver := range peerConnection.GetReceivers() {
+		if receiver.Track() == nil {
+			continue
+		}
+		existingSender[receiver.Track().ID()] = true
+	}
+
+	for trackID, trackLocal := range r.trackLocals {
+		if _, ok := existingSender[trackID]; !ok {
+			if _, err := peerConnection.AddTrack(trackLocal); err != nil {
+				return fmt.Errorf("add track %s: %w", trackID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *Participant) armAnswerTimeoutLocked(offerID uint64, logger *zerolog.Logger) {
+	if p.negotiation.answerTimer != nil {
+		p.negotiation.answerTimer.Stop()
+	}
+
+	p.negotiation.answerTimer = time.AfterFunc(negotiationAnswerTimeout, func() {
+		rtcConn := p.rtcConnection()
+
+		p.negotiation.mu.Lock()
+		if p.negotiation.state != negotiationAwaitingAnswer || p.negotiation.offerCounter != offerID {
+			p.negotiation.mu.Unlock()
+			return
+		}
+
+		logger.Warn().Str("room_id", p.Room.ID).Str("participant_id", p.ID).Msg("no answer received for offer, rolling back and renegotiating")
+		metrics.NegotiationRetries.WithLabelValues("answer_timeout").Inc()
+		p.rollbackLocalOfferLocked(rtcConn, logger)
+		p.negotiation.state = negotiationStable
+		p.negotiation.mu.Unlock()
+
+		p.Room.Renegotiate(p, logger)
+	})
+}
+
+// rollbackLocalOfferLocked takes the connection from the caller, since the
+// room lock cannot be taken while the negotiation lock is held.
+func (p *Participant) rollbackLocalOfferLocked(rtcConn core.RTCConnection, logger *zerolog.Logger) {
+	if rtcConn == nil {
+		return
+	}
+
+	peerConnection := rtcConn.GetPeerConnection()
+	if peerConnection == nil || peerConnection.SignalingState() != webrtc.SignalingStateHaveLocalOffer {
+		return
+	}
+
+	if err := peerConnection.SetLocalDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeRollback}); err != nil {
+		logger.Error().Err(err).Str("participant_id", p.ID).Msg("failed to roll back local offer")
+	}
+}
+
+// beginRemoteOffer resolves offer glare before a client offer is applied. Any
+// offer the server has in flight is rolled back and queued for later.
+func (p *Participant) beginRemoteOffer(rtcConn core.RTCConnection, logger *zerolog.Logger) {
+	p.negotiation.mu.Lock()
+	defer p.negotiation.mu.Unlock()
+
+	if p.negotiation.state == negotiationAwaitingAnswer {
+		logger.Debug().Str("room_id", p.Room.ID).Str("participant_id", p.ID).Msg("offer glare detected, rolling back server offer")
+		p.rollbackLocalOfferLocked(rtcConn, logger)
+		metrics.NegotiationRetries.WithLabelValues("glare").Inc()
+		p.negotiation.pending = true
+	}
+
+	if p.negotiation.answerTimer != nil {
+		p.negotiation.answerTimer.Stop()
+	}
+
+	p.negotiation.state = negotiationAnsweringOffer
+}
+
+// endRemoteOffer marks the client offer as answered and flushes any queued
+// changes.
+func (p *Participant) endRemoteOffer(logger *zerolog.Logger) {
+	p.negotiation.mu.Lock()
+	p.negotiation.state = negotiationStable
+	pending := p.negotiation.pending
+	p.negotiation.mu.Unlock()
+
+	if pending {
+		p.Room.Renegotiate(p, logger)
+	}
+}
+
+func (p *Participant) handleRemoteAnswer(ctx context.Context, sdp webrtc.SessionDescription, logger *zerolog.Logger) error {
+	rtcConn := p.rtcConnection()
+
+	p.negotiation.mu.Lock()
+
+	if rtcConn == nil {
+		p.negotiation.mu.Unlock()
+		return fmt.Errorf("no RTC connection for participant %s", p.ID)
+	}
+
+	if p.negotiation.state != negotiationAwaitingAnswer {
+		state := p.negotiation.state
+		p.negotiation.mu.Unlock()
+		logger.Warn().Str("room_id", p.Room.ID).Str("participant_id", p.ID).Str("negotiation_state", state.String()).Msg("ignoring unexpected SDP answer")
+		return nil
+	}
+
+	if p.negotiation.answerTimer != nil {
+		p.negotiation.answerTimer.Stop()
+	}
+
+	err := rtcConn.HandleSDPAnswer(ctx, sdp, logger)
+	if err != nil {
+		p.rollbackLocalOfferLocked(rtcConn, logger)
+		metrics.NegotiationRetries.WithLabelValues("bad_answer").Inc()
+		p.negotiation.pending = true
+	}
+
+	p.negotiation.state = negotiationStable
+	pending := p.negotiation.pending
+	p.negotiation.mu.Unlock()
+
+	if pending {
+		p.Room.Renegotiate(p, logger)
+	}
+
+	return err
+}
+
+func (p *Participant) resetNegotiation() {
+	p.negotiation.mu.Lock()
+	defer p.negotiation.mu.Unlock()
+
+	if p.negotiation.answerTimer != nil {
+		p.negotiation.answerTimer.Stop()
+	}
+
+	p.negotiation.state = negotiationStable
+	p.negotiation.pending = false
+	p.negotiation.failures = 0
+}
+
+// Renegotiate runs a single negotiation round for one participant.
+func (r *Room) Renegotiate(p *Participant, logger *zerolog.Logger) {
+	r.mu.Lock()
+	if _, ok := r.Participants[p.ID]; !ok {
+		r.mu.Unlock()
+		return
+	}
+	r.negotiateLocked(p, r.GetTracksUnlocked(logger), logger)
+	r.mu.Unlock()
+
+	r.dispatchKeyFrame()
+}
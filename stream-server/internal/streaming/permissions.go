@@ -0,0 +1,86 @@
+package streaming
+
+import (
+	"errors"
+
+	"stream-server/internal/core"
+)
+
+var ErrRoleCapacityExceeded = errors.New("room is full for this role")
+
+// PermissionsForRole returns the room's permissions for role, falling back to
+// the shared role templates.
+func (r *Room) PermissionsForRole(role string) core.Permissions {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.permissionsForRoleLocked(role)
+}
+
+func (r *Room) permissionsForRoleLocked(role string) core.Permissions {
+	if permissions, ok := r.Policy.RolePermissions[role]; ok {
+		return permissions
+	}
+	return core.RoleTemplates[role]
+}
+
+// access returns the participant's role and permissions. ChangeRole updates
+// them under the room lock, so they are read under it too.
+func (p *Participant) access() (string, core.Permissions) {
+	p.Room.mu.RLock()
+	defer p.Room.mu.RUnlock()
+	return p.Role, p.Permissions
+}
+
+// RoleOf returns the role and permissions userID connects with. A role set by
+// ChangeRole replaces the guest or audience role of the user's token, so an
+// older token cannot undo a demotion.
+func (r *Room) RoleOf(userID string, role string, permissions core.Permissions) (string, core.Permissions) {
+	if role != core.RoleGuest && role != core.RoleAudience {
+		return role, permissions
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	changed, ok := r.roles[userID]
+	if !ok || changed == role {
+		return role, permissions
+	}
+	return changed, r.permissionsForRoleLocked(changed)
+}
+
+// CheckRoleCapacity reports an error if the room has no free slot for role.
+func (r *Room) CheckRoleCapacity(role string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.checkRoleCapacityLocked(role, "")
+}
+
+// checkRoleCapacityLocked counts participants holding role, ignoring
+// excludeID so a participant is not counted against its own slot.
+func (r *Room) checkRoleCapacityLocked(role string, excludeID string) error {
+	capacity := r.Policy.RoleCapacity[role]
+	if capacity == 0 {
+		return nil
+	}
+
+	count := 0
+	for id, p := range r.Participants {
+		if id != excludeID && p.Role == role {
+			count++
+		}
+	}
+	// Participants connected to other nodes of the room hold slots too.
+	for _, l := range r.relayLinks() {
+		for id, remoteRole := range l.participants {
+			if _, local := r.Participants[id]; !local && id != excludeID && remoteRole == role {
+				count++
+			}
+		}
+	}
+
+	if count >= capacity {
+		return ErrRoleCapacityExceeded
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package streaming
+
+import "time"
+
+// RoomPersister saves rooms so they can be restored after a restart. It is
+// called synchronously and never with a room locked.
+type RoomPersister interface {
+	// RoomChanged is called after a room's bans or invites change.
+	RoomChanged(room *Room)
+	// RoomClosed is called before a room that has ended for good is removed,
+	// so that it cannot be restored while it is being torn down.
+	RoomClosed(room *Room, at time.Time)
+}
+
+// SetPersister persists rooms created from now on. Edge copies of rooms owned
+// by other nodes are never persisted.
+func (rm *RoomManager) SetPersister(persister RoomPersister) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.persister = persister
+}
+
+func (r *Room) persistChanges() {
+	if r.persister != nil {
+		r.persister.RoomChanged(r)
+	}
+}
+
+// BannedUsers returns the users banned from the room.
+func (r *Room) BannedUsers() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]string, 0, len(r.bannedUsers))
+	for userID := range r.bannedUsers {
+		users = append(users, userID)
+	}
+	return users
+}
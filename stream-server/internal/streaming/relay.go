@@ -0,0 +1,805 @@
+package streaming
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"stream-server/internal/directory"
+	"stream-server/internal/metrics"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog"
+)
+
+// Rooms that outgrow their node cascade: once a room holds edgeThreshold
+// participants on the node that owns it, new joiners are sent to another node.
+// That node keeps an edge copy of the room linked to the owner, and each side
+// relays the tracks published on it to the other. The owner is the hub, so
+// every edge sees the tracks of every other edge.
+//
+// Links carry RTP over a WebSocket, that is over TCP, rather than over a
+// WebRTC or plain UDP connection. Nodes already reach each other over HTTP
+// with relay tokens, and this needs no extra ports, ICE or DTLS between them.
+// The cost is head-of-line blocking: a lost segment delays every track on the
+// link until it is retransmitted. Links run between nodes of one cluster,
+// where loss is rare, and packets are dropped rather than queued once a link
+// backs up, so a slow link costs quality rather than growing latency.
+
+var ErrRoomNotFound = errors.New("room not found")
+
+// RelayConn carries one room between two nodes: JSON control messages as text
+// frames and RTP packets as binary frames. A *websocket.Conn satisfies it.
+type RelayConn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// RelayDialer opens a relay link to the node that owns a room.
+type RelayDialer func(ctx context.Context, owner directory.Entry) (RelayConn, error)
+
+const (
+	relayQueueSize = 1024
+	// Control messages have their own queue so they never wait behind
+	// packets. A link that falls this far behind on them is closed.
+	relayControlQueueSize = 256
+	relayWriteTimeout     = 10 * time.Second
+	relayHandshakeTimeout = 10 * time.Second
+	// Edge copies close soon after their last participant leaves; the room
+	// itself lives on at its owner.
+	edgeEmptyTimeout = 30 * time.Second
+)
+
+const (
+	relayRoomInfo        = "room_info"
+	relayRoomUpdated     = "room_updated"
+	relayTrackAdded      = "track_added"
+	relayTrackRemoved    = "track_removed"
+	relayKeyFrameRequest = "keyframe_request"
+	relayParticipants    = "participants"
+	relayKick            = "kick"
+	relayBan             = "ban"
+	relayChangeRole      = "change_role"
+)
+
+type relayMessage struct {
+	Type          string      `json:"type"`
+	Room          *relayRoom  `json:"room,omitempty"`
+	Track         *relayTrack `json:"track,omitempty"`
+	ClientTrackID string      `json:"client_track_id,omitempty"`
+	// Participants are those reachable through the sending node: its own and,
+	// on the owner, those of every other edge.
+	Participants  []relayParticipant `json:"participants,omitempty"`
+	ParticipantID string             `json:"participant_id,omitempty"`
+	Role          string             `json:"role,omitempty"`
+	Reason        string             `json:"reason,omitempty"`
+}
+
+// relayRoom carries what an edge needs to enforce the owner's rules. Joins
+// are admitted by the owner, so the access policy is informational.
+type relayRoom struct {
+	Name      string       `json:"name"`
+	CreatedBy string       `json:"created_by"`
+	TenantID  string       `json:"tenant_id"`
+	CreatedAt time.Time    `json:"created_at"`
+	Policy    RoomPolicy   `json:"policy"`
+	Access    AccessPolicy `json:"access"`
+	Bans      []string     `json:"bans"`
+}
+
+type relayParticipant struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+type relayTrack struct {
+	ClientTrackID   string `json:"client_track_id"`
+	TrackID         string `json:"track_id"`
+	StreamID        string `json:"stream_id"`
+	ParticipantID   string `json:"participant_id"`
+	ParticipantName string `json:"participant_name"`
+	Kind            string `json:"kind"`
+	MimeType        string `json:"mime_type"`
+	ClockRate       uint32 `json:"clock_rate"`
+	Channels        uint16 `json:"channels"`
+	SDPFmtpLine     string `json:"sdp_fmtp_line"`
+}
+
+func newRelayTrack(clientTrackID string, meta TrackMeta) relayTrack {
+	codec := meta.TrackLocal.Codec()
+	return relayTrack{
+		ClientTrackID:   clientTrackID,
+		TrackID:         meta.TrackLocal.ID(),
+		StreamID:        meta.TrackLocal.StreamID(),
+		ParticipantID:   meta.ParticipantID,
+		ParticipantName: meta.ParticipantName,
+		Kind:            meta.Kind,
+		MimeType:        codec.MimeType,
+		ClockRate:       codec.ClockRate,
+		Channels:        codec.Channels,
+		SDPFmtpLine:     codec.SDPFmtpLine,
+	}
+}
+
+// A binary frame is the length of the client track id as a big-endian
+// uint16, the id, and the RTP packet.
+func encodeRelayPacket(clientTrackID string, packet []byte) []byte {
+	frame := make([]byte, 2+len(clientTrackID)+len(packet))
+	binary.BigEndian.PutUint16(frame, uint16(len(clientTrackID)))
+	copy(frame[2:], clientTrackID)
+	copy(frame[2+len(clientTrackID):], packet)
+	return frame
+}
+
+func decodeRelayPacket(frame []byte) (string, []byte, bool) {
+	if len(frame) < 2 {
+		return "", nil, false
+	}
+	n := int(binary.BigEndian.Uint16(frame))
+	if len(frame) < 2+n {
+		return "", nil, false
+	}
+	return string(frame[2 : 2+n]), frame[2+n:], true
+}
+
+type relayFrame struct {
+	messageType int
+	data        []byte
+}
+
+type relayLink struct {
+	room *Room
+	conn RelayConn
+	// peer is the node at the other end of the link.
+	peer      string
+	queue     chan relayFrame
+	control   chan relayFrame
+	done      chan struct{}
+	closeOnce sync.Once
+	packet    rtp.Packet
+	// participants maps the participants reachable through the link to their
+	// roles. Guarded by room.mu.
+	participants map[string]string
+	// syncMu keeps participant snapshots in order on the link.
+	syncMu sync.Mutex
+	logger *zerolog.Logger
+}
+
+func newRelayLink(room *Room, conn RelayConn, peer string, logger *zerolog.Logger) *relayLink {
+	return &relayLink{
+		room:    room,
+		conn:    conn,
+		peer:    peer,
+		queue:   make(chan relayFrame, relayQueueSize),
+		control: make(chan relayFrame, relayControlQueueSize),
+		done:    make(chan struct{}),
+		logger:  logger,
+	}
+}
+
+// run serves the link until either side closes it, then drops the tracks that
+// arrived on it.
+func (l *relayLink) run() {
+	metrics.RelayLinks.Inc()
+	defer metrics.RelayLinks.Dec()
+
+	go l.writePump()
+	defer l.close()
+	defer l.room.removeRelay(l)
+	l.room.addRelay(l)
+
+	for {
+		messageType, data, err := l.conn.ReadMessage()
+		if err != nil {
+			l.logger.Info().Err(err).Str("room_id", l.room.ID).Str("peer_node", l.peer).Msg("relay link closed")
+			return
+		}
+		switch messageType {
+		case websocket.BinaryMessage:
+			l.handlePacket(data)
+		case websocket.TextMessage:
+			l.handleControl(data)
+		}
+	}
+}
+
+// writePump sends queued control messages ahead of queued packets.
+func (l *relayLink) writePump() {
+	for {
+		var frame relayFrame
+		select {
+		case frame = <-l.control:
+		default:
+			select {
+			case <-l.done:
+				return
+			case frame = <-l.control:
+			case frame = <-l.queue:
+			}
+		}
+
+		_ = l.conn.SetWriteDeadline(time.Now().Add(relayWriteTimeout))
+		if err := l.conn.WriteMessage(frame.messageType, frame.data); err != nil {
+			l.logger.Warn().Err(err).Str("room_id", l.room.ID).Str("peer_node", l.peer).Msg("failed to write to relay link")
+			l.close()
+			return
+		}
+	}
+}
+
+func (l *relayLink) close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		_ = l.conn.Close()
+	})
+}
+
+// sendControl never blocks the caller, which may be a publisher or another
+// link's read loop. Dropping a control message would leave the nodes out of
+// step, so a link whose control queue is full is closed instead. Its edge room
+// closes with it, and participants who rejoin get a freshly linked copy.
+func (l *relayLink) sendControl(message relayMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		l.logger.Error().Err(err).Str("type", message.Type).Msg("failed to encode relay message")
+		return
+	}
+	select {
+	case l.control <- relayFrame{messageType: websocket.TextMessage, data: data}:
+	case <-l.done:
+	default:
+		l.logger.Warn().Str("room_id", l.room.ID).Str("peer_node", l.peer).Str("type", message.Type).Msg("relay link control queue full, closing link")
+		l.close()
+	}
+}
+
+// sendPacket never blocks the publisher; packets are dropped while the link
+// is backed up.
+func (l *relayLink) sendPacket(clientTrackID string, packet []byte) {
+	select {
+	case l.queue <- relayFrame{messageType: websocket.BinaryMessage, data: encodeRelayPacket(clientTrackID, packet)}:
+		metrics.RelayPackets.WithLabelValues("sent").Inc()
+	default:
+		metrics.RelayPackets.WithLabelValues("dropped").Inc()
+	}
+}
+
+// requestKeyFrame never blocks either; a request dropped while the link is
+// backed up is repeated by the next one.
+func (l *relayLink) requestKeyFrame(clientTrackID string) {
+	data, err := json.Marshal(relayMessage{Type: relayKeyFrameRequest, ClientTrackID: clientTrackID})
+	if err != nil {
+		return
+	}
+	select {
+	case l.queue <- relayFrame{messageType: websocket.TextMessage, data: data}:
+	default:
+		l.logger.Debug().Str("room_id", l.room.ID).Str("peer_node", l.peer).Msg("relay link backed up, dropping key frame request")
+	}
+}
+
+func (l *relayLink) handleControl(data []byte) {
+	var message relayMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		l.logger.Warn().Err(err).Str("room_id", l.room.ID).Str("peer_node", l.peer).Msg("invalid relay message")
+		return
+	}
+
+	switch message.Type {
+	case relayTrackAdded:
+		if message.Track != nil {
+			l.room.addRelayedTrack(l, *message.Track)
+		}
+	case relayTrackRemoved:
+		l.room.removeRelayedTrack(l, message.ClientTrackID)
+	case relayKeyFrameRequest:
+		l.room.requestKeyFrame(l, message.ClientTrackID)
+	case relayParticipants:
+		l.room.setRemoteParticipants(l, message.Participants)
+	case relayRoomUpdated:
+		if message.Room != nil && l == l.room.origin {
+			l.room.SetName(message.Room.Name)
+			l.room.UpdatePolicy(edgePolicy(message.Room.Policy))
+		}
+	case relayKick:
+		if err := l.room.kickParticipant(message.ParticipantID, message.Reason, l, l.logger); err != nil {
+			l.logger.Debug().Err(err).Str("room_id", l.room.ID).Str("peer_node", l.peer).Msg("relayed kick not applied")
+		}
+	case relayBan:
+		if err := l.room.banUser(message.ParticipantID, message.Reason, l, l.logger); err != nil {
+			l.logger.Debug().Err(err).Str("room_id", l.room.ID).Str("peer_node", l.peer).Msg("relayed ban not applied")
+		}
+	case relayChangeRole:
+		if err := l.room.changeRole(message.ParticipantID, message.Role, l, l.logger); err != nil {
+			l.logger.Warn().Err(err).Str("room_id", l.room.ID).Str("peer_node", l.peer).Msg("relayed role change not applied")
+		}
+	default:
+		l.logger.Debug().Str("type", message.Type).Str("peer_node", l.peer).Msg("ignoring unknown relay message")
+	}
+}
+
+func (l *relayLink) handlePacket(frame []byte) {
+	clientTrackID, packet, ok := decodeRelayPacket(frame)
+	if !ok {
+		return
+	}
+
+	l.room.mu.RLock()
+	meta, exists := l.room.trackMeta[clientTrackID]
+	l.room.mu.RUnlock()
+	// Packets may arrive before track_added or after track_removed.
+	if !exists || meta.relay != l {
+		return
+	}
+	metrics.RelayPackets.WithLabelValues("received").Inc()
+
+	if err := l.packet.Unmarshal(packet); err != nil {
+		return
+	}
+	l.packet.Extension = false
+	l.packet.Extensions = nil
+	if err := meta.TrackLocal.WriteRTP(&l.packet); err != nil {
+		l.logger.Debug().Err(err).Str("client_track_id", clientTrackID).Msg("failed to write relayed packet")
+	}
+
+	l.room.relayPacket(clientTrackID, packet, l)
+}
+
+// IsEdge reports whether the room is a copy of a room owned by another node.
+func (r *Room) IsEdge() bool {
+	return r.origin != nil
+}
+
+func (r *Room) relayLinks() []*relayLink {
+	if links := r.relays.Load(); links != nil {
+		return *links
+	}
+	return nil
+}
+
+// addRelay starts relaying to l, announcing the tracks and participants the
+// room already has.
+func (r *Room) addRelay(l *relayLink) {
+	r.mu.Lock()
+	links := append(slices.Clone(r.relayLinks()), l)
+	r.relays.Store(&links)
+	tracks := make([]relayTrack, 0, len(r.trackMeta))
+	for clientTrackID, meta := range r.trackMeta {
+		tracks = append(tracks, newRelayTrack(clientTrackID, meta))
+	}
+	r.mu.Unlock()
+
+	for i := range tracks {
+		l.sendControl(relayMessage{Type: relayTrackAdded, Track: &tracks[i]})
+	}
+	r.sendRelayParticipants(l)
+}
+
+func (r *Room) removeRelay(l *relayLink) {
+	r.mu.Lock()
+	links := slices.DeleteFunc(slices.Clone(r.relayLinks()), func(link *relayLink) bool {
+		return link == l
+	})
+	r.relays.Store(&links)
+
+	var removed []string
+	for clientTrackID, meta := range r.trackMeta {
+		if meta.relay == l {
+			delete(r.trackMeta, clientTrackID)
+			delete(r.trackLocals, meta.TrackLocal.ID())
+			removed = append(removed, clientTrackID)
+		}
+	}
+	hadParticipants := len(l.participants) > 0
+	l.participants = nil
+	r.mu.Unlock()
+
+	for _, clientTrackID := range removed {
+		r.relayTrackRemoved(clientTrackID, l)
+	}
+	if hadParticipants {
+		r.syncRelayParticipants(l)
+	}
+	if len(removed) > 0 {
+		r.SignalPeerConnections(l.logger)
+	}
+}
+
+func (r *Room) closeRelays() {
+	// The origin link may not have been added to the relays yet.
+	if r.origin != nil {
+		r.origin.close()
+	}
+	for _, l := range r.relayLinks() {
+		l.close()
+	}
+}
+
+// relayTrackAdded announces a track on every link but the one it came from.
+func (r *Room) relayTrackAdded(clientTrackID string, meta TrackMeta, from *relayLink) {
+	links := r.relayLinks()
+	if len(links) == 0 {
+		return
+	}
+	track := newRelayTrack(clientTrackID, meta)
+	for _, l := range links {
+		if l != from {
+			l.sendControl(relayMessage{Type: relayTrackAdded, Track: &track})
+		}
+	}
+}
+
+func (r *Room) relayTrackRemoved(clientTrackID string, from *relayLink) {
+	for _, l := range r.relayLinks() {
+		if l != from {
+			l.sendControl(relayMessage{Type: relayTrackRemoved, ClientTrackID: clientTrackID})
+		}
+	}
+}
+
+func (r *Room) relayPacket(clientTrackID string, packet []byte, from *relayLink) {
+	for _, l := range r.relayLinks() {
+		if l != from {
+			l.sendPacket(clientTrackID, packet)
+		}
+	}
+}
+
+// syncRelayParticipants tells every link other than except which participants
+// are reachable through the rest of the room, so that each node can enforce
+// role capacity across the cluster and route moderation.
+func (r *Room) syncRelayParticipants(except *relayLink) {
+	for _, l := range r.relayLinks() {
+		if l != except {
+			r.sendRelayParticipants(l)
+		}
+	}
+}
+
+func (r *Room) sendRelayParticipants(l *relayLink) {
+	l.syncMu.Lock()
+	defer l.syncMu.Unlock()
+
+	r.mu.RLock()
+	participants := make([]relayParticipant, 0, len(r.Participants))
+	for _, p := range r.Participants {
+		participants = append(participants, relayParticipant{ID: p.ID, Role: p.Role})
+	}
+	for _, other := range r.relayLinks() {
+		if other == l {
+			continue
+		}
+		for id, role := range other.participants {
+			participants = append(participants, relayParticipant{ID: id, Role: role})
+		}
+	}
+	r.mu.RUnlock()
+
+	l.sendControl(relayMessage{Type: relayParticipants, Participants: participants})
+}
+
+func (r *Room) setRemoteParticipants(from *relayLink, participants []relayParticipant) {
+	roles := make(map[string]string, len(participants))
+	for _, p := range participants {
+		roles[p.ID] = p.Role
+	}
+
+	r.mu.Lock()
+	from.participants = roles
+	r.mu.Unlock()
+
+	r.syncRelayParticipants(from)
+}
+
+// relayLinkOf returns the link, other than except, through which a
+// participant of another node is reachable.
+func (r *Room) relayLinkOf(participantID string, except *relayLink) *relayLink {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, l := range r.relayLinks() {
+		if _, ok := l.participants[participantID]; ok && l != except {
+			return l
+		}
+	}
+	return nil
+}
+
+// relayRoomUpdated passes a policy change on to the room's edges.
+func (r *Room) relayRoomUpdated() {
+	if r.IsEdge() {
+		return
+	}
+	links := r.relayLinks()
+	if len(links) == 0 {
+		return
+	}
+	info := r.relayRoomInfo()
+	for _, l := range links {
+		l.sendControl(relayMessage{Type: relayRoomUpdated, Room: &info})
+	}
+}
+
+func (r *Room) relayRoomInfo() relayRoom {
+	access := r.AccessPolicy()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info := relayRoom{
+		Name:      r.Name,
+		CreatedBy: r.CreatedBy,
+		TenantID:  r.TenantID,
+		CreatedAt: r.CreatedAt,
+		Policy:    r.Policy,
+		Access:    access,
+	}
+	for userID := range r.bannedUsers {
+		info.Bans = append(info.Bans, userID)
+	}
+	sort.Strings(info.Bans)
+	return info
+}
+
+// edgePolicy adapts the owner's policy for an edge copy, which closes soon
+// after it empties since the room itself lives on at its owner.
+func edgePolicy(policy RoomPolicy) RoomPolicy {
+	emptyTimeout := edgeEmptyTimeout
+	policy.EmptyTimeout = &emptyTimeout
+	policy.Access = AccessPolicy{}
+	return policy
+}
+
+// addRelayedTrack makes a track published on another node available to the
+// room's subscribers as if it had been published here.
+func (r *Room) addRelayedTrack(from *relayLink, track relayTrack) {
+	codec := webrtc.RTPCodecCapability{
+		MimeType:    track.MimeType,
+		ClockRate:   track.ClockRate,
+		Channels:    track.Channels,
+		SDPFmtpLine: track.SDPFmtpLine,
+	}
+	trackLocal, err := webrtc.NewTrackLocalStaticRTP(codec, track.TrackID, track.StreamID)
+	if err != nil {
+		from.logger.Error().Err(err).Str("room_id", r.ID).Str("track_id", track.TrackID).Msg("failed to create relayed track")
+		return
+	}
+
+	meta := TrackMeta{
+		TrackLocal:      trackLocal,
+		ParticipantID:   track.ParticipantID,
+		ParticipantName: track.ParticipantName,
+		Kind:            track.Kind,
+		relay:           from,
+	}
+
+	r.mu.Lock()
+	if _, exists := r.trackMeta[track.ClientTrackID]; exists {
+		r.mu.Unlock()
+		return
+	}
+	r.trackLocals[track.TrackID] = trackLocal
+	r.trackMeta[track.ClientTrackID] = meta
+	r.mu.Unlock()
+
+	from.logger.Debug().
+		Str("room_id", r.ID).
+		Str("client_track_id", track.ClientTrackID).
+		Str("participant_id", track.ParticipantID).
+		Str("peer_node", from.peer).
+		Msg("added relayed track")
+
+	r.scheduleSync(from.logger)
+	r.relayTrackAdded(track.ClientTrackID, meta, from)
+}
+
+func (r *Room) removeRelayedTrack(from *relayLink, clientTrackID string) {
+	r.mu.Lock()
+	meta, exists := r.trackMeta[clientTrackID]
+	if !exists || meta.relay != from {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.trackMeta, clientTrackID)
+	r.mu.Unlock()
+
+	r.RemoveTrack(meta.TrackLocal, from.logger)
+	r.relayTrackRemoved(clientTrackID, from)
+}
+
+// requestKeyFrame asks a track's publisher for a key frame, passing the
+// request on towards the node the publisher is on.
+func (r *Room) requestKeyFrame(from *relayLink, clientTrackID string) {
+	r.mu.RLock()
+	meta, exists := r.trackMeta[clientTrackID]
+	if !exists {
+		r.mu.RUnlock()
+		return
+	}
+	if meta.relay != nil {
+		r.mu.RUnlock()
+		if meta.relay != from {
+			meta.relay.requestKeyFrame(clientTrackID)
+		}
+		return
+	}
+	defer r.mu.RUnlock()
+
+	publisher, ok := r.Participants[meta.ParticipantID]
+	if !ok || publisher.rtcConn == nil {
+		return
+	}
+	peerConnection := publisher.rtcConn.GetPeerConnection()
+	if peerConnection == nil {
+		return
+	}
+	for _, receiver := range peerConnection.GetReceivers() {
+		if track := receiver.Track(); track != nil && track.ID() == meta.TrackLocal.ID() {
+			_ = peerConnection.WriteRTCP([]rtcp.Packet{
+				&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())},
+			})
+		}
+	}
+}
+
+// EnableCascading lets rooms that hold edgeThreshold participants on this node
+// overflow to other nodes, and lets this node host edge copies of rooms owned
+// elsewhere, linked to their owner through dial.
+func (rm *RoomManager) EnableCascading(edgeThreshold int, dial RelayDialer) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.edgeThreshold = edgeThreshold
+	rm.relayDialer = dial
+}
+
+// EdgeNode returns the node new joiners of room should connect to: the least
+// loaded other node once the room holds edgeThreshold participants here.
+func (rm *RoomManager) EdgeNode(ctx context.Context, room *Room) (Node, bool) {
+	if rm.relayDialer == nil || room.IsEdge() || room.GetParticipantCount() < rm.edgeThreshold {
+		return Node{}, false
+	}
+	// The host admits lobby participants from the owner.
+	if room.GetPolicy().Lobby {
+		return Node{}, false
+	}
+
+	nodes, err := rm.directory.Nodes(ctx)
+	if err != nil {
+		rm.logger.Warn().Err(err).Str("room_id", room.ID).Msg("failed to list nodes for edge selection")
+		return Node{}, false
+	}
+
+	var edge *directory.NodeEntry
+	for i, node := range nodes {
+		if node.NodeID == rm.node.ID || node.NodeURL == "" {
+			continue
+		}
+		if edge == nil || node.Participants < edge.Participants {
+			edge = &nodes[i]
+		}
+	}
+	if edge == nil {
+		return Node{}, false
+	}
+	return Node{ID: edge.NodeID, URL: edge.NodeURL}, true
+}
+
+// EdgeRoom returns this node's edge copy of a room owned by another node,
+// creating it and linking it to the owner on first use.
+func (rm *RoomManager) EdgeRoom(ctx context.Context, roomID string) (*Room, error) {
+	if rm.relayDialer == nil {
+		return nil, ErrRoomNotFound
+	}
+	if rm.IsDraining() {
+		return nil, ErrDraining
+	}
+
+	owner, ok, err := rm.LookupRemoteRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+
+	conn, err := rm.relayDialer(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link room %s to node %s: %w", roomID, owner.NodeID, err)
+	}
+	info, err := readRelayRoom(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to link room %s to node %s: %w", roomID, owner.NodeID, err)
+	}
+
+	access, err := newRoomAccess(info.Access)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	rm.mu.Lock()
+	if room, ok := rm.Rooms[roomID]; ok {
+		rm.mu.Unlock()
+		conn.Close()
+		return room, nil
+	}
+
+	tenant := rm.tenantLocked(owner.TenantID)
+	if err := tenant.acquireRoom(); err != nil {
+		rm.mu.Unlock()
+		conn.Close()
+		return nil, err
+	}
+
+	room := rm.newRoom(roomID, info.Name, info.CreatedBy, owner.TenantID, tenant, edgePolicy(info.Policy), access, info.CreatedAt)
+	for _, userID := range info.Bans {
+		room.bannedUsers[userID] = true
+	}
+	room.origin = newRelayLink(room, conn, owner.NodeID, rm.logger)
+	rm.Rooms[roomID] = room
+	rm.mu.Unlock()
+
+	go func() {
+		room.origin.run()
+		rm.closeEdgeRoom(room)
+	}()
+
+	rm.logger.Info().Str("room_id", roomID).Str("owner_node", owner.NodeID).Msg("edge room created")
+	return room, nil
+}
+
+func readRelayRoom(conn RelayConn) (relayRoom, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(relayHandshakeTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return relayRoom{}, err
+	}
+	var message relayMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return relayRoom{}, err
+	}
+	if message.Type != relayRoomInfo || message.Room == nil {
+		return relayRoom{}, fmt.Errorf("unexpected relay message %q", message.Type)
+	}
+	return *message.Room, nil
+}
+
+// closeEdgeRoom closes an edge room whose link to the owner went away, unless
+// the room was already closed.
+func (rm *RoomManager) closeEdgeRoom(room *Room) {
+	rm.mu.RLock()
+	current := rm.Rooms[room.ID]
+	rm.mu.RUnlock()
+
+	if current == room {
+		rm.logger.Info().Str("room_id", room.ID).Msg("link to owning node lost, closing edge room")
+		rm.DeleteRoom(room.ID)
+	}
+}
+
+// ServeRelay relays room to and from the edge node peer until the link
+// closes.
+func (rm *RoomManager) ServeRelay(room *Room, conn RelayConn, peer string) {
+	link := newRelayLink(room, conn, peer, rm.logger)
+
+	info := room.relayRoomInfo()
+	link.sendControl(relayMessage{Type: relayRoomInfo, Room: &info})
+
+	rm.logger.Info().Str("room_id", room.ID).Str("peer_node", peer).Msg("relaying room to edge node")
+	link.run()
+}
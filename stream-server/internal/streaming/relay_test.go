@@ -0,0 +1,318 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"stream-server/internal/core"
+	"stream-server/internal/directory"
+	"stream-server/internal/rtc"
+
+	"github.com/rs/zerolog"
+)
+
+// pipeConn is one end of an in-memory relay link. Closing either end closes
+// both, like a dropped connection.
+type pipeConn struct {
+	in   <-chan relayFrame
+	out  chan<- relayFrame
+	done chan struct{}
+	once *sync.Once
+}
+
+func newPipe() (*pipeConn, *pipeConn) {
+	ab := make(chan relayFrame, 64)
+	ba := make(chan relayFrame, 64)
+	done := make(chan struct{})
+	once := &sync.Once{}
+	return &pipeConn{in: ba, out: ab, done: done, once: once},
+		&pipeConn{in: ab, out: ba, done: done, once: once}
+}
+
+func (c *pipeConn) ReadMessage() (int, []byte, error) {
+	select {
+	case frame := <-c.in:
+		return frame.messageType, frame.data, nil
+	case <-c.done:
+		return 0, nil, errors.New("pipe closed")
+	}
+}
+
+func (c *pipeConn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case c.out <- relayFrame{messageType: messageType, data: data}:
+		return nil
+	case <-c.done:
+		return errors.New("pipe closed")
+	}
+}
+
+func (c *pipeConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *pipeConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *pipeConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+type testConn struct {
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *testConn) Send([]byte) error { return nil }
+func (c *testConn) Close()            { c.once.Do(func() { close(c.closed) }) }
+func (c *testConn) Read() ([]byte, error) {
+	<-c.closed
+	return nil, errors.New("closed")
+}
+
+type cluster struct {
+	owner *RoomManager
+	edge  *RoomManager
+}
+
+func newCluster(t *testing.T) cluster {
+	t.Helper()
+	logger := zerolog.Nop()
+	dir := directory.NewMemory()
+
+	owner := NewRoomManager(&logger, rtc.DefaultConfig(), DefaultRoomPolicy())
+	owner.SetDirectory(dir, Node{ID: "owner", URL: "http://owner"})
+	edge := NewRoomManager(&logger, rtc.DefaultConfig(), DefaultRoomPolicy())
+	edge.SetDirectory(dir, Node{ID: "edge", URL: "http://edge"})
+
+	edge.EnableCascading(1, func(ctx context.Context, entry directory.Entry) (RelayConn, error) {
+		room, ok := owner.GetRoom(entry.RoomID)
+		if !ok {
+			return nil, ErrRoomNotFound
+		}
+		local, remote := newPipe()
+		go owner.ServeRelay(room, remote, "edge")
+		return local, nil
+	})
+
+	t.Cleanup(func() {
+		owner.CloseAllRooms()
+		edge.CloseAllRooms()
+	})
+	return cluster{owner: owner, edge: edge}
+}
+
+func (c cluster) rooms(t *testing.T, policy RoomPolicy) (*Room, *Room) {
+	t.Helper()
+	ownerRoom, _, err := c.owner.CreateRoom("room-1", "Room", "host", "default", policy)
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	edgeRoom, err := c.edge.EdgeRoom(context.Background(), "room-1")
+	if err != nil {
+		t.Fatalf("EdgeRoom: %v", err)
+	}
+	// The owner registers the link once it starts serving it.
+	eventually(t, "owner to see the edge link", func() bool {
+		return len(ownerRoom.relayLinks()) == 1
+	})
+	return ownerRoom, edgeRoom
+}
+
+func join(t *testing.T, room *Room, id string, role string) *Participant {
+	t.Helper()
+	p := &Participant{
+		ID:          id,
+		Name:        id,
+		Role:        role,
+		Permissions: room.PermissionsForRole(role),
+		Conn:        &testConn{closed: make(chan struct{})},
+		Room:        room,
+		SendChan:    make(chan core.Message, 64),
+		JoinedAt:    time.Now(),
+	}
+	logger := zerolog.Nop()
+	if err := room.AddParticipant(p, &logger); err != nil {
+		t.Fatalf("AddParticipant(%s): %v", id, err)
+	}
+	return p
+}
+
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func hasParticipant(room *Room, id string) bool {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	_, ok := room.Participants[id]
+	return ok
+}
+
+func TestRelayPacketFraming(t *testing.T) {
+	frame := encodeRelayPacket("track-1", []byte{1, 2, 3})
+	id, packet, ok := decodeRelayPacket(frame)
+	if !ok || id != "track-1" || string(packet) != string([]byte{1, 2, 3}) {
+		t.Fatalf("decodeRelayPacket = %q, %v, %v", id, packet, ok)
+	}
+
+	for _, frame := range [][]byte{nil, {0}, {0, 5, 'a'}} {
+		if _, _, ok := decodeRelayPacket(frame); ok {
+			t.Errorf("decodeRelayPacket(%v) accepted a truncated frame", frame)
+		}
+	}
+}
+
+func TestEdgeRoomCopiesOwnerRules(t *testing.T) {
+	c := newCluster(t)
+	logger := zerolog.Nop()
+
+	policy := RoomPolicy{
+		MaxDuration:  time.Hour,
+		RoleCapacity: map[string]int{core.RoleGuest: 3},
+		Access:       AccessPolicy{InviteOnly: true, InvitedUsers: []string{"alice"}},
+	}
+	ownerRoom, _, err := c.owner.CreateRoom("room-1", "Room", "host", "default", policy)
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if err := ownerRoom.BanUser("mallory", "spam", &logger); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+
+	edgeRoom, err := c.edge.EdgeRoom(context.Background(), "room-1")
+	if err != nil {
+		t.Fatalf("EdgeRoom: %v", err)
+	}
+
+	edgePolicy := edgeRoom.GetPolicy()
+	if edgePolicy.RoleCapacity[core.RoleGuest] != 3 || edgePolicy.MaxDuration != time.Hour {
+		t.Errorf("edge policy = %+v, want the owner's capacity and duration", edgePolicy)
+	}
+	if edgePolicy.EmptyTimeoutDuration() != edgeEmptyTimeout {
+		t.Errorf("edge empty timeout = %v, want %v", edgePolicy.EmptyTimeoutDuration(), edgeEmptyTimeout)
+	}
+	if !edgeRoom.CreatedAt.Equal(ownerRoom.CreatedAt) {
+		t.Errorf("edge created at %v, owner at %v", edgeRoom.CreatedAt, ownerRoom.CreatedAt)
+	}
+	if !edgeRoom.IsBanned("mallory") {
+		t.Error("ban on the owner was not copied to the edge")
+	}
+	if access := edgeRoom.AccessPolicy(); !access.InviteOnly || len(access.InvitedUsers) != 1 {
+		t.Errorf("edge access policy = %+v, want the owner's", access)
+	}
+
+	ownerRoom.UpdatePolicy(RoomPolicy{RoleCapacity: map[string]int{core.RoleGuest: 5}})
+	eventually(t, "policy update to reach the edge", func() bool {
+		return edgeRoom.GetPolicy().RoleCapacity[core.RoleGuest] == 5
+	})
+}
+
+func TestRoleCapacitySpansNodes(t *testing.T) {
+	c := newCluster(t)
+	ownerRoom, edgeRoom := c.rooms(t, RoomPolicy{RoleCapacity: map[string]int{core.RoleGuest: 1, core.RoleAudience: 1}})
+
+	join(t, ownerRoom, "guest-1", core.RoleGuest)
+	eventually(t, "edge to count the owner's guest", func() bool {
+		return errors.Is(edgeRoom.CheckRoleCapacity(core.RoleGuest), ErrRoleCapacityExceeded)
+	})
+
+	join(t, edgeRoom, "audience-1", core.RoleAudience)
+	eventually(t, "owner to count the edge's audience", func() bool {
+		return errors.Is(ownerRoom.CheckRoleCapacity(core.RoleAudience), ErrRoleCapacityExceeded)
+	})
+
+	logger := zerolog.Nop()
+	if err := ownerRoom.KickParticipant("audience-1", "", &logger); err != nil {
+		t.Fatalf("KickParticipant: %v", err)
+	}
+	eventually(t, "owner to free the audience slot", func() bool {
+		return ownerRoom.CheckRoleCapacity(core.RoleAudience) == nil
+	})
+}
+
+func TestModerationReachesEdge(t *testing.T) {
+	c := newCluster(t)
+	ownerRoom, edgeRoom := c.rooms(t, RoomPolicy{RoleCapacity: map[string]int{core.RoleGuest: 5}})
+	logger := zerolog.Nop()
+
+	join(t, edgeRoom, "bob", core.RoleGuest)
+	join(t, edgeRoom, "carol", core.RoleGuest)
+	dave := join(t, edgeRoom, "dave", core.RoleGuest)
+	eventually(t, "owner to learn the edge's participants", func() bool {
+		return ownerRoom.relayLinkOf("dave", nil) != nil
+	})
+
+	if err := ownerRoom.KickParticipant("carol", "off topic", &logger); err != nil {
+		t.Fatalf("KickParticipant: %v", err)
+	}
+	eventually(t, "kick to reach the edge", func() bool { return !hasParticipant(edgeRoom, "carol") })
+
+	if err := ownerRoom.BanUser("bob", "spam", &logger); err != nil {
+		t.Fatalf("BanUser: %v", err)
+	}
+	eventually(t, "ban to reach the edge", func() bool {
+		return edgeRoom.IsBanned("bob") && !hasParticipant(edgeRoom, "bob")
+	})
+
+	if err := ownerRoom.ChangeRole("dave", core.RoleAudience, &logger); err != nil {
+		t.Fatalf("ChangeRole: %v", err)
+	}
+	eventually(t, "role change to reach the edge", func() bool {
+		edgeRoom.mu.RLock()
+		defer edgeRoom.mu.RUnlock()
+		return dave.Role == core.RoleAudience
+	})
+
+	if err := ownerRoom.KickParticipant("nobody", "", &logger); err == nil {
+		t.Error("kicking an unknown participant succeeded")
+	}
+}
+
+func TestEdgeRoomClosesWithOwner(t *testing.T) {
+	c := newCluster(t)
+	_, edgeRoom := c.rooms(t, RoomPolicy{})
+	join(t, edgeRoom, "guest-1", core.RoleGuest)
+
+	c.owner.DeleteRoom("room-1")
+	eventually(t, "edge room to close", func() bool {
+		_, ok := c.edge.GetRoom("room-1")
+		return !ok
+	})
+}
+
+func TestBackedUpLinkIsClosedNotWaitedOn(t *testing.T) {
+	logger := zerolog.Nop()
+	// Nothing reads the other end, so writes stall once the pipe is full.
+	conn, _ := newPipe()
+	link := newRelayLink(&Room{ID: "room-1"}, conn, "node-2", &logger)
+	go link.writePump()
+	t.Cleanup(link.close)
+
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*relayControlQueueSize; i++ {
+			link.sendPacket("track-1", []byte{0x80})
+			link.sendControl(relayMessage{Type: relayParticipants})
+		}
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sendControl blocked on a backed-up link")
+	}
+	select {
+	case <-link.done:
+	default:
+		t.Error("backed-up link was not closed")
+	}
+}
@@ -1,61 +1,129 @@
 package streaming
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"stream-server/internal/core"
+	"stream-server/internal/directory"
+	"stream-server/internal/metrics"
 	"stream-server/internal/rtc"
+	"stream-server/internal/tracing"
 
 	"github.com/pion/webrtc/v4"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+const maxPendingICECandidates = 64
+
 type Participant struct {
-	ID        string
-	Name      string
-	Role      string
-	Conn      core.Connection
-	rtcConn   core.RTCConnection
-	Room      *Room
-	Status    string
-	SendChan  chan core.Message
-	JoinedAt  time.Time
-	closeOnce sync.Once
+	ID   string
+	Name string
+	// Role and Permissions change with ChangeRole once the participant has
+	// joined and are then guarded by Room.mu.
+	Role        string
+	Permissions core.Permissions
+	Conn        core.Connection
+	// rtcConn is guarded by Room.mu.
+	rtcConn     core.RTCConnection
+	Room        *Room
+	Status      string
+	SendChan    chan core.Message
+	JoinedAt    time.Time
+	negotiation negotiator
+	// pendingICE holds the client's candidates until the peer connection has
+	// its remote description.
+	pendingICE []webrtc.ICECandidateInit
+	// localICE holds the server's candidates until the answer they belong
+	// to has been sent.
+	localICE   []webrtc.ICECandidateInit
+	answerSent bool
+	iceMu      sync.Mutex
+	onStage    bool
+	closeOnce  sync.Once
+
+	stats           ParticipantStats
+	lastSample      statsSample
+	statsSubscribed bool
+	framesIn        atomic.Uint64
 }
 
 type TrackMeta struct {
-	TrackLocal    *webrtc.TrackLocalStaticRTP
-	ParticipantID string
-	Kind          string
+	TrackLocal      *webrtc.TrackLocalStaticRTP
+	ParticipantID   string
+	ParticipantName string
+	Kind            string
+	// relay is the link a track published on another node arrives on; nil
+	// for tracks published here.
+	relay *relayLink
 }
 
 type Room struct {
-	Name         string
-	ID           string
-	Participants map[string]*Participant
-	trackLocals  map[string]*webrtc.TrackLocalStaticRTP
-	trackMeta    map[string]TrackMeta
-	CreatedAt    time.Time
-	CreatedBy    string
-	syncTimer    *time.Timer
-	mu           sync.RWMutex
+	Name            string
+	ID              string
+	Participants    map[string]*Participant
+	trackLocals     map[string]*webrtc.TrackLocalStaticRTP
+	trackMeta       map[string]TrackMeta
+	CreatedAt       time.Time
+	CreatedBy       string
+	Policy          RoomPolicy
+	syncTimer       *time.Timer
+	emptySince      time.Time
+	closingNotified bool
+	bannedUsers     map[string]bool
+	raisedHands     map[string]time.Time
+	// roles holds the roles set by ChangeRole, which outlive the tokens
+	// users joined with.
+	roles    map[string]string
+	lobby    map[string]*lobbyEntry
+	TenantID string
+	tenant   *tenantUsage
+	access   roomAccess
+	events   *EventBus
+	// finished is set once room_finished was emitted; later events, such as
+	// tracks ending while the room is torn down, are not published.
+	finished  bool
+	emitMu    sync.Mutex
+	persister RoomPersister
+	// origin links an edge copy of the room to the node that owns it.
+	origin *relayLink
+	relays atomic.Pointer[[]*relayLink]
+	mu     sync.RWMutex
 }
 
 type RoomManager struct {
-	Rooms  map[string]*Room
-	mu     sync.RWMutex
-	logger *zerolog.Logger
+	Rooms         map[string]*Room
+	rtcConfig     rtc.Config
+	defaultPolicy RoomPolicy
+	tenants       map[string]*tenantUsage
+	events        *EventBus
+	draining      atomic.Bool
+	directory     directory.Directory
+	node          Node
+	edgeThreshold int
+	relayDialer   RelayDialer
+	persister     RoomPersister
+	mu            sync.RWMutex
+	logger        *zerolog.Logger
 }
 
-func NewRoomManager(logger *zerolog.Logger) *RoomManager {
+func NewRoomManager(logger *zerolog.Logger, rtcConfig rtc.Config, defaultPolicy RoomPolicy) *RoomManager {
 	return &RoomManager{
-		Rooms:  make(map[string]*Room),
-		logger: logger,
+		Rooms:         make(map[string]*Room),
+		rtcConfig:     rtcConfig,
+		defaultPolicy: defaultPolicy,
+		tenants:       make(map[string]*tenantUsage),
+		events:        NewEventBus(logger),
+		directory:     directory.NewMemory(),
+		node:          Node{ID: "local"},
+		logger:        logger,
 	}
 }
 
@@ -63,29 +131,98 @@ func (rm *RoomManager) GetLogger() *zerolog.Logger {
 	return rm.logger
 }
 
-func (rm *RoomManager) CreateRoom(roomID string, roomName string, createdBy string) (*Room, bool) {
+func (rm *RoomManager) DefaultRoomPolicy() RoomPolicy {
+	return rm.defaultPolicy
+}
+
+func (rm *RoomManager) CreateRoom(roomID string, roomName string, createdBy string, tenantID string, policy RoomPolicy) (*Room, bool, error) {
+	return rm.createRoom(roomID, roomName, createdBy, tenantID, policy, time.Now(), nil)
+}
+
+// RestoreRoom recreates a room that was created by an earlier run of the
+// server, keeping its original creation time and bans.
+func (rm *RoomManager) RestoreRoom(roomID string, roomName string, createdBy string, tenantID string, createdAt time.Time, policy RoomPolicy, bans []string) (*Room, bool, error) {
+	return rm.createRoom(roomID, roomName, createdBy, tenantID, policy, createdAt, bans)
+}
+
+func (rm *RoomManager) createRoom(roomID string, roomName string, createdBy string, tenantID string, policy RoomPolicy, createdAt time.Time, bans []string) (*Room, bool, error) {
+	access, err := newRoomAccess(policy.Access)
+	if err != nil {
+		return nil, false, err
+	}
+	policy.Access = AccessPolicy{}
+
+	if rm.IsDraining() {
+		return nil, false, ErrDraining
+	}
+
+	rm.mu.RLock()
+	room, ok := rm.Rooms[roomID]
+	rm.mu.RUnlock()
+	if ok {
+		rm.logger.Debug().Str("room_id", roomID).Msg("room already exists")
+		return room, true, nil
+	}
+
+	// The directory is consulted without holding rm.mu since it may be remote.
+	claimed, err := rm.claimRoom(roomID, tenantID, createdAt)
+	if err != nil {
+		return nil, false, err
+	}
+	if !claimed {
+		return nil, true, nil
+	}
+
 	rm.mu.Lock()
-	defer rm.mu.Unlock()
 
 	if room, ok := rm.Rooms[roomID]; ok {
+		rm.mu.Unlock()
 		rm.logger.Debug().Str("room_id", roomID).Msg("room already exists")
-		return room, true
+		return room, true, nil
 	}
 
-	room := &Room{
+	tenant := rm.tenantLocked(tenantID)
+	if err := tenant.acquireRoom(); err != nil {
+		rm.mu.Unlock()
+		rm.releaseRoom(roomID)
+		rm.logger.Warn().Str("room_id", roomID).Str("tenant_id", tenantID).Err(err).Msg("room quota exceeded")
+		return nil, false, err
+	}
+
+	room = rm.newRoom(roomID, roomName, createdBy, tenantID, tenant, policy.Merge(rm.defaultPolicy), access, createdAt)
+	room.persister = rm.persister
+	for _, userID := range bans {
+		room.bannedUsers[userID] = true
+	}
+	rm.Rooms[roomID] = room
+	rm.mu.Unlock()
+
+	rm.logger.Info().Str("room_id", roomID).Str("tenant_id", tenantID).Msg("room created")
+	room.emit(Event{Type: EventRoomStarted, ParticipantID: createdBy})
+	return room, false, nil
+}
+
+func (rm *RoomManager) newRoom(roomID string, roomName string, createdBy string, tenantID string, tenant *tenantUsage, policy RoomPolicy, access roomAccess, createdAt time.Time) *Room {
+	return &Room{
 		Name:         roomName,
 		ID:           roomID,
 		Participants: make(map[string]*Participant),
 		trackLocals:  make(map[string]*webrtc.TrackLocalStaticRTP),
 		trackMeta:    make(map[string]TrackMeta),
-		CreatedAt:    time.Now(),
+		CreatedAt:    createdAt,
 		CreatedBy:    createdBy,
+		Policy:       policy,
 		syncTimer:    nil,
+		emptySince:   time.Now(),
+		bannedUsers:  make(map[string]bool),
+		raisedHands:  make(map[string]time.Time),
+		roles:        make(map[string]string),
+		lobby:        make(map[string]*lobbyEntry),
+		TenantID:     tenantID,
+		tenant:       tenant,
+		access:       access,
+		events:       rm.events,
 	}
-	rm.Rooms[roomID] = room
-
-	rm.logger.Info().Str("room_id", roomID).Msg("room created")
-	return room, false
 }
 
 func (rm *RoomManager) GetRoom(roomID string) (*Room, bool) {
@@ -100,7 +237,33 @@ func (rm *RoomManager) GetRoom(roomID string) (*Room, bool) {
 	return room, true
 }
 
+func (rm *RoomManager) ListRooms() []*Room {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	rooms := make([]*Room, 0, len(rm.Rooms))
+	for _, room := range rm.Rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
 func (rm *RoomManager) DeleteRoom(roomID string) {
+	rm.deleteRoom(roomID, ReasonDeleted)
+}
+
+// deleteRoom closes the room; reason is reported in its room_finished event.
+func (rm *RoomManager) deleteRoom(roomID string, reason string) {
+	// Rooms closed by a shutdown are restored when they are joined again.
+	if reason != ReasonServerShutdown {
+		rm.mu.RLock()
+		room, ok := rm.Rooms[roomID]
+		rm.mu.RUnlock()
+		if ok && room.persister != nil {
+			room.persister.RoomClosed(room, time.Now())
+		}
+	}
+
 	rm.mu.Lock()
 	room, ok := rm.Rooms[roomID]
 	if !ok {
@@ -110,17 +273,27 @@ func (rm *RoomManager) DeleteRoom(roomID string) {
 	}
 
 	participants := make([]*Participant, 0, len(room.Participants))
-	room.mu.RLock()
+	room.mu.Lock()
 	for _, p := range room.Participants {
 		participants = append(participants, p)
 	}
-	room.mu.RUnlock()
+	room.decideAllLocked(false)
+	room.mu.Unlock()
 	delete(rm.Rooms, roomID)
+	room.tenant.releaseRoom()
 	rm.mu.Unlock()
 
 	for _, p := range participants {
+		room.sendRoomClosed(p, reason, rm.logger)
 		room.RemoveParticipant(p, rm.logger)
 	}
+	room.closeRelays()
+	if !room.IsEdge() {
+		room.emit(Event{Type: EventRoomFinished, Reason: reason})
+		rm.releaseRoom(roomID)
+	} else {
+		room.finish()
+	}
 
 	rm.logger.Info().Str("room_id", roomID).Msg("room deleted")
 }
@@ -151,14 +324,24 @@ func (rm *RoomManager) CloseAllRooms() {
 
 	for _, room := range rooms {
 		participants := make([]*Participant, 0, len(room.Participants))
-		room.mu.RLock()
+		room.mu.Lock()
 		for _, p := range room.Participants {
 			participants = append(participants, p)
 		}
-		room.mu.RUnlock()
+		room.decideAllLocked(false)
+		room.mu.Unlock()
+		room.tenant.releaseRoom()
 		for _, p := range participants {
+			room.sendRoomClosed(p, ReasonServerShutdown, rm.logger)
 			room.RemoveParticipant(p, rm.logger)
 		}
+		room.closeRelays()
+		if !room.IsEdge() {
+			room.emit(Event{Type: EventRoomFinished, Reason: ReasonServerShutdown})
+			rm.releaseRoom(room.ID)
+		} else {
+			room.finish()
+		}
 	}
 
 	rm.logger.Info().Msg("all rooms closed")
@@ -166,6 +349,8 @@ func (rm *RoomManager) CloseAllRooms() {
 
 func (r *Room) AddParticipant(p *Participant, logger *zerolog.Logger) error {
 	logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("adding participant to room")
+	defer r.syncRelayParticipants(nil)
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -174,10 +359,36 @@ func (r *Room) AddParticipant(p *Participant, logger *zerolog.Logger) error {
 		return fmt.Errorf("participant %s already exists in room %s", p.ID, r.ID)
 	}
 
+	if r.bannedUsers[p.ID] {
+		logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("banned user attempted to join room")
+		return fmt.Errorf("participant %s is banned from room %s", p.ID, r.ID)
+	}
+
+	if p.Role != "host" && !r.Policy.ScheduledStart.IsZero() && time.Now().Before(r.Policy.ScheduledStart) {
+		logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Time("scheduled_start", r.Policy.ScheduledStart).Msg("room has not started yet")
+		return fmt.Errorf("room %s has not started yet", r.ID)
+	}
+
+	if err := r.checkRoleCapacityLocked(p.Role, p.ID); err != nil {
+		logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Str("role", p.Role).Msg("role capacity reached")
+		return err
+	}
+
+	if err := r.tenant.acquireParticipant(); err != nil {
+		logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Str("tenant_id", r.TenantID).Err(err).Msg("participant quota exceeded")
+		return err
+	}
+
 	r.Participants[p.ID] = p
 	participantCount := len(r.Participants)
 
+	if p.Role == core.RoleHost {
+		r.sendLobbyRequestsLocked(p, logger)
+		r.sendRaisedHandsLocked(p, logger)
+	}
+
 	logger.Info().Str("room_id", r.ID).Str("participant_id", p.ID).Int("participant_count", participantCount).Msg("participant added to room")
+	r.emit(Event{Type: EventParticipantJoined, ParticipantID: p.ID, ParticipantName: p.Name, Role: p.Role})
 	/*
 		if participantCount > 1 {
 			joinMsg := Message{
@@ -204,13 +415,22 @@ func (r *Room) RemoveParticipant(p *Participant, logger *zerolog.Logger) {
 		}
 
 		delete(r.Participants, p.ID)
+		delete(r.raisedHands, p.ID)
+		r.tenant.releaseParticipant()
 		participantCount := len(r.Participants)
+		if participantCount == 0 {
+			r.emptySince = time.Now()
+		}
 
+		rtcConn := p.rtcConn
+		p.rtcConn = nil
+		role := p.Role
 		r.mu.Unlock()
 
-		if p.rtcConn != nil {
-			_ = p.rtcConn.Close(logger)
+		if rtcConn != nil {
+			_ = rtcConn.Close(logger)
 		}
+		p.resetNegotiation()
 		p.Conn.Close()
 		close(p.SendChan)
 
@@ -223,6 +443,8 @@ func (r *Room) RemoveParticipant(p *Participant, logger *zerolog.Logger) {
 			}
 			r.Broadcast(p.ID, leaveMsg, logger)
 		}
+		r.emit(Event{Type: EventParticipantLeft, ParticipantID: p.ID, ParticipantName: p.Name, Role: role})
+		r.syncRelayParticipants(nil)
 
 		logger.Info().
 			Str("room_id", r.ID).
@@ -238,7 +460,7 @@ func (r *Room) ListRTCParticipant() []*Participant {
 
 	participants := make([]*Participant, 0)
 	for _, p := range r.Participants {
-		if p.Role != "audience" && p.rtcConn != nil {
+		if p.Permissions.UsesPeerConnection() && p.rtcConn != nil {
 			participants = append(participants, p)
 		}
 	}
@@ -257,6 +479,7 @@ func (r *Room) Broadcast(senderID string, message core.Message, logger *zerolog.
 		select {
 		case p.SendChan <- message:
 		default:
+			metrics.SignalingMessagesDropped.WithLabelValues("broadcast").Inc()
 			logger.Warn().Str("room_id", r.ID).Str("sender_id", senderID).Str("receiver_id", id).Msg("dropping message, send channel full")
 		}
 	}
@@ -273,6 +496,7 @@ func (r *Room) sendBackLocked(senderID string, message core.Message, logger *zer
 		logger.Debug().Str("room_id", r.ID).Str("sender_id", senderID).Str("message_type", message.Type).Msg("message sent to participant")
 		return nil
 	default:
+		metrics.SignalingMessagesDropped.WithLabelValues("send_back").Inc()
 		logger.Warn().Str("room_id", r.ID).Str("sender_id", senderID).Msg("failed to send message, channel full")
 		return fmt.Errorf("channel full for participant %s", senderID)
 	}
@@ -299,6 +523,7 @@ func (r *Room) SendTo(senderID string, receiverID string, message core.Message,
 		logger.Debug().Str("room_id", r.ID).Str("sender_id", senderID).Str("receiver_id", receiverID).Str("message_type", message.Type).Msg("message sent to participant")
 		return nil
 	default:
+		metrics.SignalingMessagesDropped.WithLabelValues("send_to").Inc()
 		logger.Warn().Str("room_id", r.ID).Str("sender_id", senderID).Str("receiver_id", receiverID).Msg("failed to send message, channel full")
 		return fmt.Errorf("not able to send the message to %s", receiverID)
 	}
@@ -316,31 +541,62 @@ func (r *Room) IsEmpty() bool {
 	return len(r.Participants) == 0
 }
 
-func (r *Room) GetParticipantList() string {
+type ParticipantInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Status   string `json:"status"`
+	JoinedAt int64  `json:"joined_at"`
+}
+
+func (r *Room) ListParticipants() []ParticipantInfo {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
+	return r.listParticipantsLocked()
+}
 
-	participants := make([]map[string]interface{}, 0, len(r.Participants))
+func (r *Room) listParticipantsLocked() []ParticipantInfo {
+	participants := make([]ParticipantInfo, 0, len(r.Participants))
 	for _, p := range r.Participants {
-		participants = append(participants, map[string]interface{}{
-			"id":        p.ID,
-			"name":      p.Name,
-			"role":      p.Role,
-			"status":    p.Status,
-			"joined_at": p.JoinedAt.Unix(),
+		participants = append(participants, ParticipantInfo{
+			ID:       p.ID,
+			Name:     p.Name,
+			Role:     p.Role,
+			Status:   p.Status,
+			JoinedAt: p.JoinedAt.Unix(),
 		})
 	}
+	return participants
+}
+
+func (r *Room) GetParticipantList() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	result := map[string]interface{}{
 		"participant_count": len(r.Participants),
-		"participants":      participants,
+		"participants":      r.listParticipantsLocked(),
 	}
 
 	data, _ := json.Marshal(result)
 	return string(data)
 }
 
-func (p *Participant) ReadPump(r *Room, rm *RoomManager, logger *zerolog.Logger) {
+func (r *Room) GetName() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Name
+}
+
+func (r *Room) SetName(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Name = name
+}
+
+// ReadPump handles the participant's signaling messages until the connection
+// closes. Each message gets a span that is a child of the span in ctx.
+func (p *Participant) ReadPump(ctx context.Context, r *Room, rm *RoomManager, logger *zerolog.Logger) {
 	defer func() {
 		r.RemoveParticipant(p, logger)
 		logger.Info().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("connection closed, participant removed")
@@ -368,57 +624,92 @@ func (p *Participant) ReadPump(r *Room, rm *RoomManager, logger *zerolog.Logger)
 
 		logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Str("message_type", msg.Type).Msg("processing message")
 
-		switch msg.Type {
+		msgCtx, span := tracing.Start(ctx, "signaling."+msg.Type,
+			attribute.String("room_id", r.ID),
+			attribute.String("participant_id", p.ID),
+		)
+		p.handleMessage(msgCtx, r, rm, msg, tracing.Logger(msgCtx, logger))
+		span.End()
+	}
+}
 
-		case "chat":
-			r.Broadcast(p.ID, msg, logger)
-			logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("chat message broadcasted")
+// handleMessage processes one signaling message from the participant. ctx
+// carries the message's span.
+func (p *Participant) handleMessage(ctx context.Context, r *Room, rm *RoomManager, msg core.Message, logger *zerolog.Logger) {
+	role, permissions := p.access()
 
-		case "sdp":
+	switch msg.Type {
 
-			if p.Role == "audience" {
-				logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("audience member sent an SDP message, ignoring")
-				continue
-			}
-			sdp := *msg.SDP
+	case "chat":
+		if !permissions.CanChat {
+			logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("participant without chat permission sent a chat message, ignoring")
+			p.Conn.Send([]byte(`{"type":"error","message":"Chat is not permitted"}`))
+			return
+		}
+		r.Broadcast(p.ID, msg, logger)
+		logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("chat message broadcasted")
 
-			if sdp.Type == webrtc.SDPTypeOffer {
-				var err error
-				tracksMetaData := msg.IncomingTracks
+	case "sdp":
 
-				logger.Debug().Msgf("Processing %d incoming tracks", len(tracksMetaData))
-				for _, trackMetaData := range tracksMetaData {
+		if !permissions.UsesPeerConnection() {
+			logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("participant without media permissions sent an SDP message, ignoring")
+			return
+		}
+		sdp := *msg.SDP
 
-					logger.Debug().
-						Str("room_id", r.ID).
-						Str("participant_id", trackMetaData.ParticipantID).
-						Str("track_id", trackMetaData.ClientTrackID).
-						Str("track_kind", trackMetaData.Kind).
-						Msg("Incoming track metadata")
-
-					if _, exists := r.Participants[trackMetaData.ParticipantID]; !exists {
-						log.Warn().Str("room_id", r.ID).Str("participant_id", trackMetaData.ParticipantID).Msg("SDP offer send by participant that doesn't exist in room")
-						continue
-					}
+		if sdp.Type == webrtc.SDPTypeOffer {
+			var err error
+			tracksMetaData := msg.IncomingTracks
+			if !permissions.CanPublish {
+				tracksMetaData = nil
+			}
 
+			logger.Debug().Msgf("Processing %d incoming tracks", len(tracksMetaData))
+			for _, trackMetaData := range tracksMetaData {
+
+				logger.Debug().
+					Str("room_id", r.ID).
+					Str("participant_id", trackMetaData.ParticipantID).
+					Str("track_id", trackMetaData.ClientTrackID).
+					Str("track_kind", trackMetaData.Kind).
+					Msg("Incoming track metadata")
+
+				r.mu.RLock()
+				_, exists := r.Participants[trackMetaData.ParticipantID]
+				r.mu.RUnlock()
+				if !exists {
+					log.Warn().Str("room_id", r.ID).Str("participant_id", trackMetaData.ParticipantID).Msg("SDP offer send by participant that doesn't exist in room")
+					continue
 				}
 
-				if p.rtcConn != nil {
+			}
+
+			rtcConn := p.rtcConnection()
+			if rtcConn != nil {
+				peerConnection := rtcConn.GetPeerConnection()
+				if peerConnection == nil ||
+					peerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed ||
+					peerConnection.ConnectionState() == webrtc.PeerConnectionStateFailed {
 					logger.Warn().
 						Str("room_id", r.ID).
 						Str("participant_id", p.ID).
-						Msg("Existing RTC connection found cleaning up before creating new one")
-
-					p.rtcConn.Close(logger)
-					p.rtcConn = nil
+						Msg("Existing RTC connection is no longer usable, replacing it")
 
-					time.Sleep(200 * time.Millisecond)
+					p.setRTCConnection(nil)
+					rtcConn.Close(logger)
+					rtcConn = nil
 				}
+			}
 
-				p.rtcConn, err = rtc.NewPionRTCConnection(p, tracksMetaData, logger, p.Room)
+			if rtcConn == nil {
+				p.resetNegotiation()
+				p.resetLocalICE()
+				rtcConn, err = rtc.NewPionRTCConnection(p, tracksMetaData, rm.rtcConfig, logger, p.Room)
 
 				if err != nil {
 					logger.Error().Err(err).Msg("unable to create peer connection")
+					// The client starts over with a new offer and new candidates.
+					p.pendingICE = nil
 
 					errMsg := core.Message{
 						Type:    "error",
@@ -427,109 +718,153 @@ func (p *Participant) ReadPump(r *Room, rm *RoomManager, logger *zerolog.Logger)
 					}
 
 					p.Room.SendBack(p.ID, errMsg, logger)
-					continue
+					return
 
 				}
+				if !p.setRTCConnection(rtcConn) {
+					rtcConn.Close(logger)
+					return
+				}
+			} else {
+				logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("applying offer as renegotiation of existing RTC connection")
+				rtcConn.UpdateTrackMetaData(tracksMetaData)
+			}
 
-				answer, err := p.rtcConn.HandleSDPOffer(sdp, logger)
-				if err != nil {
-					logger.Error().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("unable to handle sdp offer")
+			p.beginRemoteOffer(rtcConn, logger)
+			answer, err := rtcConn.HandleSDPOffer(ctx, sdp, logger)
+			if err != nil {
+				p.endRemoteOffer(logger)
+				p.pendingICE = nil
+				logger.Error().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("unable to handle sdp offer")
+
+				errMsg := core.Message{
+					Type:    "error",
+					To:      p.ID,
+					Content: fmt.Sprintf("Failed to handle SDP offer: %v", err),
+				}
 
-					errMsg := core.Message{
-						Type:    "error",
-						To:      p.ID,
-						Content: fmt.Sprintf("Failed to handle SDP offer: %v", err),
-					}
+				p.Room.SendBack(p.ID, errMsg, logger)
+				return
+			}
+			responseTrackMetaData := r.GetTracks(logger)
+			for i, track := range responseTrackMetaData {
+				logger.Debug().
+					Int("index", i).
+					Str("track_id", track.TrackID).
+					Str("participant_id", track.ParticipantID).
+					Str("kind", track.Kind).
+					Msg("response track metadata")
+			}
+			responseMsg := core.Message{
+				Type:           "sdp",
+				SDP:            &answer,
+				OutgoingTracks: responseTrackMetaData,
+			}
 
-					p.Room.SendBack(p.ID, errMsg, logger)
-					continue
-				}
-				responseTrackMetaData := r.GetTracks(logger)
-				for i, track := range responseTrackMetaData {
-					logger.Debug().
-						Int("index", i).
-						Str("track_id", track.TrackID).
-						Str("participant_id", track.ParticipantID).
-						Str("kind", track.Kind).
-						Msg("response track metadata")
-				}
-				responseMsg := core.Message{
-					Type:           "sdp",
-					SDP:            &answer,
-					OutgoingTracks: responseTrackMetaData,
-				}
+			p.Room.SendBack(p.ID, responseMsg, logger)
+			logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("sdp answer send to the user")
+			p.flushLocalICE(logger)
 
-				p.Room.SendBack(p.ID, responseMsg, logger)
-				logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("sdp answer send to the user")
-			} else if sdp.Type == webrtc.SDPTypeAnswer {
-				if err := p.rtcConn.HandleSDPAnswer(sdp); err != nil {
-					logger.Error().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("unable to handle sdp answer")
-					errMsg := core.Message{
-						Type:    "error",
-						To:      p.ID,
-						Content: fmt.Sprintf("Failed to handle SDP answer: %v", err),
-					}
-					p.Room.SendBack(p.ID, errMsg, logger)
+			for _, candidate := range p.pendingICE {
+				if err := rtcConn.HandleICE(candidate, logger); err != nil {
+					logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("unable to add buffered ICE candidate")
+				}
+			}
+			p.pendingICE = nil
+			p.endRemoteOffer(logger)
+		} else if sdp.Type == webrtc.SDPTypeAnswer {
+			if err := p.handleRemoteAnswer(ctx, sdp, logger); err != nil {
+				logger.Error().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("unable to handle sdp answer")
+				errMsg := core.Message{
+					Type:    "error",
+					To:      p.ID,
+					Content: fmt.Sprintf("Failed to handle SDP answer: %v", err),
 				}
+				p.Room.SendBack(p.ID, errMsg, logger)
 			}
+		}
 
-		case "ice":
+	case "ice":
 
-			if p.Role == "audience" {
-				continue
-			}
+		if !permissions.UsesPeerConnection() {
+			return
+		}
 
-			if p.rtcConn == nil {
-				logger.Warn().Str("participant_id", p.ID).Msg("received ICE candidate before RTC connection was established, ignoring")
-				continue
+		rtcConn := p.rtcConnection()
+		if !hasRemoteDescription(rtcConn) {
+			if len(p.pendingICE) >= maxPendingICECandidates {
+				logger.Warn().Str("participant_id", p.ID).Msg("too many ICE candidates buffered before RTC connection was established, dropping")
+				return
 			}
-			ice := *msg.ICE
-			err := p.rtcConn.HandleICE(ice, logger)
+			logger.Debug().Str("participant_id", p.ID).Msg("received ICE candidate before RTC connection was established, buffering")
+			p.pendingICE = append(p.pendingICE, *msg.ICE)
+			return
+		}
+		ice := *msg.ICE
+		err := rtcConn.HandleICE(ice, logger)
 
-			if err != nil {
-				logger.Error().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("unable to add ICE candiate")
-			}
+		if err != nil {
+			logger.Error().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("unable to add ICE candiate")
+		}
 
-		case "get_participants":
-			participantList := r.GetParticipantList()
-			responseMsg := core.Message{
-				Type:    "participant_list",
-				Content: participantList,
-			}
-			select {
-			case p.SendChan <- responseMsg:
-				logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("participant list sent")
-			default:
-				logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("failed to send participant list, channel full")
-			}
+	case "get_participants":
+		participantList := r.GetParticipantList()
+		responseMsg := core.Message{
+			Type:    "participant_list",
+			Content: participantList,
+		}
+		select {
+		case p.SendChan <- responseMsg:
+			logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("participant list sent")
+		default:
+			metrics.SignalingMessagesDropped.WithLabelValues("send_back").Inc()
+			logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("failed to send participant list, channel full")
+		}
 
-		case "join":
-			var roomState []core.RoomState
-			for _, p := range r.Participants {
-				if p.Role != "audience" {
-					roomState = append(roomState, core.RoomState{
-						ParticipantID:   p.ID,
-						ParticipantName: p.Name,
-						Role:            p.Role,
-						Status:          p.Status,
-					})
-				}
-			}
-			joiningAck := core.Message{
-				Type:    "join_ack",
+	case "kick", "ban", "change_role", "approve_stage", "deny_stage", "remove_from_stage", "admit", "reject":
+		p.handleModeration(r, msg, logger)
+
+	case "raise_hand", "lower_hand", "leave_stage":
+		p.handleStage(r, msg, logger)
+
+	case "stats_subscribe", "stats_unsubscribe":
+		if err := r.SetStatsSubscription(p, msg.Type == "stats_subscribe", logger); err != nil {
+			logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("stats subscription rejected")
+			p.Room.SendBack(p.ID, core.Message{
+				Type:    "error",
 				To:      p.ID,
-				State:   roomState,
-				Content: fmt.Sprintf(`{"room_id":"%s","participant_id":"%s","participant_name":"%s","participant_role":"%s"}`, r.ID, p.ID, p.Name, p.Role),
+				Content: err.Error(),
+			}, logger)
+		}
+
+	case "join":
+		var roomState []core.RoomState
+		r.mu.RLock()
+		for _, p := range r.Participants {
+			if p.Permissions.CanPublish {
+				roomState = append(roomState, core.RoomState{
+					ParticipantID:   p.ID,
+					ParticipantName: p.Name,
+					Role:            p.Role,
+					Status:          p.Status,
+				})
 			}
+		}
+		r.mu.RUnlock()
+		joiningAck := core.Message{
+			Type:    "join_ack",
+			To:      p.ID,
+			State:   roomState,
+			Content: fmt.Sprintf(`{"room_id":"%s","participant_id":"%s","participant_name":"%s","participant_role":"%s"}`, r.ID, p.ID, p.Name, role),
+		}
 
-			p.Room.SendBack(p.ID, joiningAck, logger)
-			r.Broadcast(p.ID, msg, logger)
-			logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("joining message broadcasted")
+		p.Room.SendBack(p.ID, joiningAck, logger)
+		r.Broadcast(p.ID, msg, logger)
+		logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("joining message broadcasted")
 
-		default:
-			logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Str("type", msg.Type).Msg("unknown message type")
-			p.Conn.Send([]byte(`{"type":"error","message":"Unknown message type"}`))
-		}
+	default:
+		logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Str("type", msg.Type).Msg("unknown message type")
+		p.Conn.Send([]byte(`{"type":"error","message":"Unknown message type"}`))
 	}
 }
 
@@ -553,7 +888,10 @@ func (p *Participant) WritePump(logger *zerolog.Logger) {
 func (r *Room) scheduleSync(logger *zerolog.Logger) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.scheduleSyncLocked(logger)
+}
 
+func (r *Room) scheduleSyncLocked(logger *zerolog.Logger) {
 	if r.syncTimer != nil {
 		r.syncTimer.Stop()
 	}
@@ -564,18 +902,85 @@ func (r *Room) scheduleSync(logger *zerolog.Logger) {
 	})
 }
 
-func (p *Participant) OnICECandidate(candidate *webrtc.ICECandidate, logger *zerolog.Logger) error {
+func (p *Participant) rtcConnection() core.RTCConnection {
+	p.Room.mu.RLock()
+	defer p.Room.mu.RUnlock()
+	return p.rtcConn
+}
 
+// setRTCConnection reports false if the participant has already left the
+// room, in which case a new connection is not kept.
+func (p *Participant) setRTCConnection(rtcConn core.RTCConnection) bool {
+	p.Room.mu.Lock()
+	defer p.Room.mu.Unlock()
+	if _, ok := p.Room.Participants[p.ID]; !ok && rtcConn != nil {
+		return false
+	}
+	p.rtcConn = rtcConn
+	return true
+}
+
+func hasRemoteDescription(rtcConn core.RTCConnection) bool {
+	if rtcConn == nil {
+		return false
+	}
+	peerConnection := rtcConn.GetPeerConnection()
+	return peerConnection != nil && peerConnection.RemoteDescription() != nil
+}
+
+// OnICECandidate sends a server candidate to the client. With trickle ICE,
+// pion gathers candidates as soon as the answer is set locally, so candidates
+// found before the answer has been sent are held back until it is.
+func (p *Participant) OnICECandidate(candidate *webrtc.ICECandidate, logger *zerolog.Logger) error {
 	iceInit := candidate.ToJSON()
+
+	p.iceMu.Lock()
+	if !p.answerSent {
+		if len(p.localICE) >= maxPendingICECandidates {
+			p.iceMu.Unlock()
+			logger.Warn().Str("participant_id", p.ID).Msg("too many local ICE candidates buffered before the answer was sent, dropping")
+			return nil
+		}
+		p.localICE = append(p.localICE, iceInit)
+		p.iceMu.Unlock()
+		return nil
+	}
+	p.iceMu.Unlock()
+
+	p.sendICE(iceInit, logger)
+	return nil
+}
+
+func (p *Participant) resetLocalICE() {
+	p.iceMu.Lock()
+	defer p.iceMu.Unlock()
+	p.answerSent = false
+	p.localICE = nil
+}
+
+// flushLocalICE is called once the answer has been queued for the client.
+func (p *Participant) flushLocalICE(logger *zerolog.Logger) {
+	p.iceMu.Lock()
+	p.answerSent = true
+	candidates := p.localICE
+	p.localICE = nil
+	p.iceMu.Unlock()
+
+	for _, candidate := range candidates {
+		p.sendICE(candidate, logger)
+	}
+}
+
+func (p *Participant) sendICE(iceInit webrtc.ICECandidateInit, logger *zerolog.Logger) {
+	role, _ := p.access()
 	msg := core.Message{
 		Type: "ice",
 		From: p.ID,
 		To:   p.ID,
-		Role: p.Role,
+		Role: role,
 		Name: p.Name,
 		ICE:  &iceInit,
 	}
 
 	p.Room.SendBack(p.ID, msg, logger)
-	return nil
 }
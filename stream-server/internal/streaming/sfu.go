@@ -1,13 +1,19 @@
 package streaming
 
 import (
+	"context"
+	"fmt"
+
 	"stream-server/internal/core"
-	"time"
+	"stream-server/internal/metrics"
+	"stream-server/internal/tracing"
 
 	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (r *Room) AddTrack(track *webrtc.TrackRemote, logger *zerolog.Logger) *webrtc.TrackLocalStaticRTP {
@@ -41,14 +47,32 @@ func (r *Room) RemoveTrack(track *webrtc.TrackLocalStaticRTP, logger *zerolog.Lo
 }
 
 func (r *Room) dispatchKeyFrame() {
+	// Tracks relayed from other nodes get their key frames from the node the
+	// publisher is on. Those requests are sent once the room is unlocked.
+	relayed := make(map[string]*relayLink)
+	defer func() {
+		for clientTrackID, link := range relayed {
+			link.requestKeyFrame(clientTrackID)
+		}
+	}()
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	for clientTrackID, meta := range r.trackMeta {
+		if meta.relay != nil && meta.Kind == "video" {
+			relayed[clientTrackID] = meta.relay
+		}
+	}
+
 	for _, participant := range r.Participants {
-		if participant.Role == "audience" || participant.rtcConn == nil {
+		if !participant.Permissions.UsesPeerConnection() || participant.rtcConn == nil {
 			continue
 		}
 		peerConnection := participant.rtcConn.GetPeerConnection()
+		if peerConnection == nil {
+			continue
+		}
 		for _, receiver := range peerConnection.GetReceivers() {
 			if receiver.Track() == nil {
 				continue
@@ -64,112 +88,28 @@ func (r *Room) dispatchKeyFrame() {
 }
 
 func (r *Room) SignalPeerConnections(logger *zerolog.Logger) {
+	ctx, span := tracing.Start(context.Background(), "sfu.SignalPeerConnections", attribute.String("room_id", r.ID))
+	defer span.End()
+	logger = tracing.Logger(ctx, logger)
+
 	r.mu.Lock()
 
 	defer func() {
 		r.mu.Unlock()
 		r.dispatchKeyFrame()
+		r.emit(Event{Type: EventTracksSynced})
 	}()
 
 	outgoingTracks := r.GetTracksUnlocked(logger)
+	span.SetAttributes(
+		attribute.Int("participants", len(r.Participants)),
+		attribute.Int("tracks", len(outgoingTracks)),
+	)
 
-	attemptSync := func() bool {
-		logger.Debug().Str("room_id", r.ID).Msg("Attempting to sync peer connections")
-		for _, participant := range r.Participants {
-
-			if participant.Role == "audience" || participant.rtcConn == nil {
-				continue
-			}
-			peerConnection := participant.rtcConn.GetPeerConnection()
-
-			logger.Debug().Str("room_id", r.ID).Str("participant_id", participant.ID).Str("pc_state", peerConnection.ConnectionState().String()).Msg("Syncing peer connection")
-
-			if peerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed ||
-				peerConnection.ConnectionState() == webrtc.PeerConnectionStateFailed {
-				return true
-			}
-
-			existingSender := map[string]bool{}
-
-			for _, sender := range peerConnection.GetSenders() {
-
-				if sender.Track() == nil {
-					continue
-				}
-				existingSender[sender.Track().ID()] = true
-
-				if _, ok := r.trackLocals[sender.Track().ID()]; !ok {
-
-					logger.Debug().Str("room_id", r.ID).Str("participant_id", participant.ID).Str("track_id", sender.Track().ID()).Msg("removing stale track")
-					if err := peerConnection.RemoveTrack(sender); err != nil {
-						return true
-					}
-				}
-			}
-
-			for _, receiver := range peerConnection.GetReceivers() {
-
-				if receiver.Track() == nil {
-					continue
-				}
-				existingSender[receiver.Track().ID()] = true
-			}
-
-			for trackID := range r.trackLocals {
-				if _, ok := existingSender[trackID]; !ok {
-					if _, err := peerConnection.AddTrack(r.trackLocals[trackID]); err != nil {
-						return true
-					}
-				}
-			}
-
-			if peerConnection.SignalingState() != webrtc.SignalingStateStable {
-				logger.Warn().
-					Str("participant_id", participant.ID).
-					Str("state", peerConnection.SignalingState().String()).
-					Msg("PeerConnection not stable, skipping offer creation")
-				continue
-			}
-
-			offer, err := peerConnection.CreateOffer(nil)
-			if err != nil {
-				logger.Error().Err(err).Str("participant_id", participant.ID).Msg("failed to create offer")
-				continue
-			}
-
-			if err := peerConnection.SetLocalDescription(offer); err != nil {
-				logger.Error().Err(err).Str("participant_id", participant.ID).Msg("failed to set local description")
-				continue
-			}
-
-			offerMessage := core.Message{
-				Type:           "sdp",
-				SDP:            &offer,
-				OutgoingTracks: outgoingTracks,
-			}
-
-			participant.Room.sendBackLocked(participant.ID, offerMessage, logger)
-
-		}
-
-		return false
-
-	}
-
-	for syncAttempt := 0; ; syncAttempt++ {
-		if syncAttempt == 25 {
-
-			go func() {
-				time.Sleep(time.Second * 3)
-				r.SignalPeerConnections(logger)
-			}()
-
-			return
-		}
-
-		if !attemptSync() {
-			break
-		}
+	logger.Debug().Str("room_id", r.ID).Msg("Attempting to sync peer connections")
+	for _, participant := range r.Participants {
+		span.AddEvent("negotiate", trace.WithAttributes(attribute.String("participant_id", participant.ID)))
+		r.negotiateLocked(participant, outgoingTracks, logger)
 	}
 }
 
@@ -190,19 +130,24 @@ func (r *Room) GetTracksUnlocked(logger *zerolog.Logger) []core.OutgoingTrackMet
 			continue
 		}
 
-		participant, exists := r.Participants[meta.ParticipantID]
-		if !exists {
-			logger.Warn().
-				Str("participant_id", meta.ParticipantID).
-				Msg("Participant not found for trackMeta entry")
-			continue
+		// Publishers of relayed tracks are participants of another node.
+		participantName := meta.ParticipantName
+		if meta.relay == nil {
+			participant, exists := r.Participants[meta.ParticipantID]
+			if !exists {
+				logger.Warn().
+					Str("participant_id", meta.ParticipantID).
+					Msg("Participant not found for trackMeta entry")
+				continue
+			}
+			participantName = participant.Name
 		}
 
 		outgoingTracks = append(outgoingTracks, core.OutgoingTrackMetaData{
 			ClientTrackID:   clientTrackID,
 			TrackID:         meta.TrackLocal.ID(),
 			ParticipantID:   meta.ParticipantID,
-			ParticipantName: participant.Name,
+			ParticipantName: participantName,
 			Kind:            meta.Kind,
 		})
 	}
@@ -211,29 +156,40 @@ func (r *Room) GetTracksUnlocked(logger *zerolog.Logger) []core.OutgoingTrackMet
 }
 
 func (p *Participant) ForwardTracks(track *webrtc.TrackRemote, participantID string, participantName string, kind string, clientTrackID string, receiver *webrtc.RTPReceiver, logger *zerolog.Logger) error {
+	if _, permissions := p.access(); !permissions.CanPublish {
+		return fmt.Errorf("participant %s is not allowed to publish", p.ID)
+	}
 
 	trackLocal := p.Room.AddTrack(track, logger)
 
-	p.Room.mu.Lock()
-	p.Room.trackMeta[clientTrackID] = TrackMeta{
-		TrackLocal:    trackLocal,
-		ParticipantID: participantID,
-		Kind:          kind,
+	meta := TrackMeta{
+		TrackLocal:      trackLocal,
+		ParticipantID:   participantID,
+		ParticipantName: participantName,
+		Kind:            kind,
 	}
+	p.Room.mu.Lock()
+	p.Room.trackMeta[clientTrackID] = meta
 	logger.Debug().Msg("Added Meta Data")
 	p.Room.mu.Unlock()
 
 	p.Room.scheduleSync(logger)
+	p.Room.relayTrackAdded(clientTrackID, meta, nil)
+	p.Room.emit(Event{Type: EventTrackPublished, ParticipantID: participantID, ParticipantName: participantName, TrackID: clientTrackID, Kind: kind})
+	defer p.Room.emit(Event{Type: EventTrackUnpublished, ParticipantID: participantID, ParticipantName: participantName, TrackID: clientTrackID, Kind: kind})
 
 	defer p.Room.RemoveTrack(trackLocal, logger)
 	defer func() {
 		p.Room.mu.Lock()
 		delete(p.Room.trackMeta, clientTrackID)
 		p.Room.mu.Unlock()
+		p.Room.relayTrackRemoved(clientTrackID, nil)
 	}()
 
 	buf := make([]byte, 1500)
 	rtpPkt := &rtp.Packet{}
+	packetsForwarded := metrics.RTPPacketsForwarded.WithLabelValues(kind)
+	bytesForwarded := metrics.RTPBytesForwarded.WithLabelValues(kind)
 
 	for {
 		i, _, err := track.Read(buf)
@@ -244,6 +200,7 @@ func (p *Participant) ForwardTracks(track *webrtc.TrackRemote, participantID str
 
 			return err
 		}
+		p.Room.relayPacket(clientTrackID, buf[:i], nil)
 
 		rtpPkt.Extension = false
 		rtpPkt.Extensions = nil
@@ -251,6 +208,11 @@ func (p *Participant) ForwardTracks(track *webrtc.TrackRemote, participantID str
 		if err = trackLocal.WriteRTP(rtpPkt); err != nil {
 			return err
 		}
+		packetsForwarded.Inc()
+		bytesForwarded.Add(float64(i))
+		if kind == "video" && rtpPkt.Marker {
+			p.framesIn.Add(1)
+		}
 	}
 
 }
@@ -0,0 +1,197 @@
+package streaming
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"stream-server/internal/core"
+	"stream-server/internal/metrics"
+
+	"github.com/rs/zerolog"
+)
+
+func stageContent(p *Participant) string {
+	content, _ := json.Marshal(map[string]string{
+		"participant_id":   p.ID,
+		"participant_name": p.Name,
+	})
+	return string(content)
+}
+
+// RaiseHand records an audience member's request to join the stage and
+// forwards it to the host.
+func (r *Room) RaiseHand(p *Participant, logger *zerolog.Logger) error {
+	r.mu.Lock()
+	if p.Role != core.RoleAudience {
+		r.mu.Unlock()
+		return fmt.Errorf("only audience members can raise their hand")
+	}
+	if _, raised := r.raisedHands[p.ID]; raised {
+		r.mu.Unlock()
+		return nil
+	}
+	r.raisedHands[p.ID] = time.Now()
+	r.mu.Unlock()
+
+	logger.Info().Str("room_id", r.ID).Str("participant_id", p.ID).Msg("audience member raised hand")
+	r.notifyHost(p.ID, handRaisedMessage(p), logger)
+	return nil
+}
+
+func handRaisedMessage(p *Participant) core.Message {
+	return core.Message{
+		Type:    "hand_raised",
+		From:    p.ID,
+		Name:    p.Name,
+		Action:  "raise_hand",
+		Content: stageContent(p),
+	}
+}
+
+func (r *Room) LowerHand(p *Participant, logger *zerolog.Logger) {
+	r.mu.Lock()
+	_, raised := r.raisedHands[p.ID]
+	delete(r.raisedHands, p.ID)
+	r.mu.Unlock()
+
+	if !raised {
+		return
+	}
+
+	r.notifyHost(p.ID, core.Message{
+		Type:    "hand_lowered",
+		From:    p.ID,
+		Name:    p.Name,
+		Action:  "lower_hand",
+		Content: stageContent(p),
+	}, logger)
+}
+
+// sendRaisedHandsLocked replays the hands raised while the host was away, in
+// the order they were raised. The caller must hold r.mu.
+func (r *Room) sendRaisedHandsLocked(host *Participant, logger *zerolog.Logger) {
+	ids := make([]string, 0, len(r.raisedHands))
+	for id := range r.raisedHands {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return r.raisedHands[ids[i]].Before(r.raisedHands[ids[j]]) })
+
+	for _, id := range ids {
+		p, ok := r.Participants[id]
+		if !ok {
+			continue
+		}
+		select {
+		case host.SendChan <- handRaisedMessage(p):
+		default:
+			metrics.SignalingMessagesDropped.WithLabelValues("stage").Inc()
+			logger.Warn().Str("room_id", r.ID).Str("participant_id", id).Msg("dropping raised hand, send channel full")
+		}
+	}
+}
+
+// ApproveStage promotes an audience member with a raised hand to a publishing
+// guest. The client is expected to follow up with an SDP offer. The hand stays
+// raised if the promotion fails, for example because the stage is full.
+func (r *Room) ApproveStage(participantID string, logger *zerolog.Logger) error {
+	r.mu.Lock()
+	p, ok := r.Participants[participantID]
+	if !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("participant %s does not exist", participantID)
+	}
+	if _, raised := r.raisedHands[participantID]; !raised {
+		r.mu.Unlock()
+		return fmt.Errorf("participant %s has not raised their hand", participantID)
+	}
+	if err := r.checkRoleCapacityLocked(core.RoleGuest, participantID); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	r.mu.Unlock()
+
+	if err := r.ChangeRole(participantID, core.RoleGuest, logger); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	delete(r.raisedHands, participantID)
+	p.onStage = true
+	r.mu.Unlock()
+
+	logger.Info().Str("room_id", r.ID).Str("participant_id", participantID).Msg("audience member promoted to stage")
+	return r.SendTo(r.CreatedBy, participantID, core.Message{
+		Type:    "stage_approved",
+		To:      participantID,
+		Role:    core.RoleGuest,
+		Action:  "approve_stage",
+		Content: stageContent(p),
+	}, logger)
+}
+
+func (r *Room) DenyStage(participantID string, logger *zerolog.Logger) error {
+	r.mu.Lock()
+	p, ok := r.Participants[participantID]
+	_, raised := r.raisedHands[participantID]
+	delete(r.raisedHands, participantID)
+	r.mu.Unlock()
+
+	if !ok || !raised {
+		return fmt.Errorf("participant %s has not raised their hand", participantID)
+	}
+
+	logger.Info().Str("room_id", r.ID).Str("participant_id", participantID).Msg("stage request denied")
+	return r.SendTo(r.CreatedBy, participantID, core.Message{
+		Type:    "stage_denied",
+		To:      participantID,
+		Action:  "deny_stage",
+		Content: stageContent(p),
+	}, logger)
+}
+
+// LeaveStage demotes a promoted participant back to the audience, which
+// unpublishes their tracks. ChangeRole takes them off the stage.
+func (r *Room) LeaveStage(participantID string, logger *zerolog.Logger) error {
+	r.mu.RLock()
+	p, ok := r.Participants[participantID]
+	onStage := ok && p.onStage
+	r.mu.RUnlock()
+	if !onStage {
+		return fmt.Errorf("participant %s is not on stage", participantID)
+	}
+
+	if err := r.ChangeRole(participantID, core.RoleAudience, logger); err != nil {
+		return err
+	}
+	logger.Info().Str("room_id", r.ID).Str("participant_id", participantID).Msg("participant left the stage")
+	return nil
+}
+
+func (r *Room) notifyHost(senderID string, msg core.Message, logger *zerolog.Logger) {
+	if err := r.SendTo(senderID, r.CreatedBy, msg, logger); err != nil {
+		logger.Debug().Str("room_id", r.ID).Str("message_type", msg.Type).Err(err).Msg("host not reachable, stage request kept pending")
+	}
+}
+
+func (p *Participant) handleStage(r *Room, msg core.Message, logger *zerolog.Logger) {
+	var err error
+	switch msg.Type {
+	case "raise_hand":
+		err = r.RaiseHand(p, logger)
+	case "lower_hand":
+		r.LowerHand(p, logger)
+	case "leave_stage":
+		err = r.LeaveStage(p.ID, logger)
+	}
+
+	if err != nil {
+		logger.Warn().Str("room_id", r.ID).Str("participant_id", p.ID).Str("type", msg.Type).Err(err).Msg("stage action failed")
+		p.Room.SendBack(p.ID, core.Message{
+			Type:    "error",
+			To:      p.ID,
+			Content: err.Error(),
+		}, logger)
+	}
+}
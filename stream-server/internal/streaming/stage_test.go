@@ -0,0 +1,99 @@
+package streaming
+
+import (
+	"testing"
+	"time"
+
+	"stream-server/internal/core"
+	"stream-server/internal/rtc"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRaisedHandsReplayedToHost(t *testing.T) {
+	logger := zerolog.Nop()
+	rm := NewRoomManager(&logger, rtc.DefaultConfig(), DefaultRoomPolicy())
+	t.Cleanup(rm.CloseAllRooms)
+	room, _, err := rm.CreateRoom("room-1", "Room", "host", DefaultTenantID, RoomPolicy{})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	join := func(id, role string) *Participant {
+		p := &Participant{
+			ID:          id,
+			Role:        role,
+			Permissions: room.PermissionsForRole(role),
+			Conn:        &scriptConn{msgs: make(chan []byte)},
+			Room:        room,
+			SendChan:    make(chan core.Message, 16),
+			JoinedAt:    time.Now(),
+		}
+		if err := room.AddParticipant(p, &logger); err != nil {
+			t.Fatalf("AddParticipant(%s): %v", id, err)
+		}
+		return p
+	}
+
+	for _, id := range []string{"alice", "bob"} {
+		if err := room.RaiseHand(join(id, core.RoleAudience), &logger); err != nil {
+			t.Fatalf("RaiseHand(%s): %v", id, err)
+		}
+	}
+	host := join("host", core.RoleHost)
+
+	for _, want := range []string{"alice", "bob"} {
+		select {
+		case msg := <-host.SendChan:
+			if msg.Type != "hand_raised" || msg.From != want {
+				t.Fatalf("host got %s from %s, want hand_raised from %s", msg.Type, msg.From, want)
+			}
+		default:
+			t.Fatalf("host did not get the hand raised by %s", want)
+		}
+	}
+}
+
+func TestApproveStageKeepsHandWhenStageIsFull(t *testing.T) {
+	logger := zerolog.Nop()
+	rm := NewRoomManager(&logger, rtc.DefaultConfig(), DefaultRoomPolicy())
+	t.Cleanup(rm.CloseAllRooms)
+	room, _, err := rm.CreateRoom("room-1", "Room", "host", DefaultTenantID, RoomPolicy{})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	join := func(id, role string) *Participant {
+		p := &Participant{
+			ID:          id,
+			Role:        role,
+			Permissions: room.PermissionsForRole(role),
+			Conn:        &scriptConn{msgs: make(chan []byte)},
+			Room:        room,
+			SendChan:    make(chan core.Message, 16),
+			JoinedAt:    time.Now(),
+		}
+		if err := room.AddParticipant(p, &logger); err != nil {
+			t.Fatalf("AddParticipant(%s): %v", id, err)
+		}
+		return p
+	}
+
+	// The default policy has room for one guest.
+	guest := join("bob", core.RoleGuest)
+	alice := join("alice", core.RoleAudience)
+	if err := room.RaiseHand(alice, &logger); err != nil {
+		t.Fatalf("RaiseHand: %v", err)
+	}
+
+	if err := room.ApproveStage("alice", &logger); err == nil {
+		t.Fatal("ApproveStage succeeded with the stage full")
+	}
+	room.RemoveParticipant(guest, &logger)
+	if err := room.ApproveStage("alice", &logger); err != nil {
+		t.Fatalf("ApproveStage once the stage has room: %v", err)
+	}
+	if role, _ := alice.access(); role != core.RoleGuest {
+		t.Errorf("alice is %s, want guest", role)
+	}
+}
@@ -0,0 +1,203 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"stream-server/internal/core"
+
+	"github.com/rs/zerolog"
+)
+
+// ParticipantStats is the connection quality of one participant over the last
+// collection interval. "In" is media the server receives from the participant
+// and "out" is media the server sends to it.
+type ParticipantStats struct {
+	ParticipantID   string    `json:"participant_id"`
+	RoundTripTimeMs float64   `json:"rtt_ms"`
+	JitterInMs      float64   `json:"jitter_in_ms"`
+	JitterOutMs     float64   `json:"jitter_out_ms"`
+	PacketLossIn    float64   `json:"packet_loss_in"`
+	PacketLossOut   float64   `json:"packet_loss_out"`
+	BitrateIn       float64   `json:"bitrate_in"`
+	BitrateOut      float64   `json:"bitrate_out"`
+	FramerateIn     float64   `json:"framerate_in"`
+	CollectedAt     time.Time `json:"collected_at"`
+}
+
+type statsSample struct {
+	rtc    core.RTCStats
+	frames uint64
+}
+
+// StartStatsCollector samples every peer connection on interval and pushes the
+// results to subscribed hosts until ctx is cancelled.
+func (rm *RoomManager) StartStatsCollector(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		rm.logger.Info().Dur("interval", interval).Msg("stats collector started")
+		for {
+			select {
+			case <-ctx.Done():
+				rm.logger.Info().Msg("stats collector stopped")
+				return
+			case <-ticker.C:
+				for _, room := range rm.ListRooms() {
+					room.collectStats(rm.logger)
+				}
+			}
+		}
+	}()
+}
+
+func (r *Room) collectStats(logger *zerolog.Logger) {
+	r.mu.RLock()
+	connections := make(map[*Participant]core.RTCConnection)
+	for _, p := range r.Participants {
+		if p.rtcConn != nil {
+			connections[p] = p.rtcConn
+		}
+	}
+	r.mu.RUnlock()
+
+	// GetStats takes the peer connection lock, so sample without the room lock.
+	samples := make(map[*Participant]statsSample, len(connections))
+	for p, rtcConn := range connections {
+		rtcStats, err := rtcConn.Stats()
+		if err != nil {
+			logger.Debug().Str("room_id", r.ID).Str("participant_id", p.ID).Err(err).Msg("unable to collect stats")
+			continue
+		}
+		samples[p] = statsSample{rtc: rtcStats, frames: p.framesIn.Load()}
+	}
+
+	r.mu.Lock()
+	for p, sample := range samples {
+		if _, ok := r.Participants[p.ID]; !ok {
+			continue
+		}
+		p.stats = computeStats(p.ID, p.lastSample, sample)
+		p.lastSample = sample
+	}
+
+	var subscribers []string
+	for id, p := range r.Participants {
+		if p.statsSubscribed {
+			subscribers = append(subscribers, id)
+		}
+	}
+	r.mu.Unlock()
+
+	if len(subscribers) == 0 {
+		return
+	}
+
+	message := r.statsMessage()
+	for _, id := range subscribers {
+		r.SendTo("", id, message, logger)
+	}
+}
+
+func computeStats(participantID string, prev statsSample, cur statsSample) ParticipantStats {
+	stats := ParticipantStats{
+		ParticipantID:   participantID,
+		RoundTripTimeMs: float64(cur.rtc.RoundTripTime) / float64(time.Millisecond),
+		JitterInMs:      cur.rtc.JitterIn * 1000,
+		JitterOutMs:     cur.rtc.JitterOut * 1000,
+		PacketLossOut:   cur.rtc.FractionLostOut,
+		CollectedAt:     cur.rtc.Timestamp,
+	}
+
+	if prev.rtc.Timestamp.IsZero() {
+		return stats
+	}
+	elapsed := cur.rtc.Timestamp.Sub(prev.rtc.Timestamp).Seconds()
+	if elapsed <= 0 {
+		return stats
+	}
+
+	// Counters restart when the peer connection is replaced; treat that
+	// interval as starting from zero.
+	delta := func(cur uint64, prev uint64) float64 {
+		if cur < prev {
+			return float64(cur)
+		}
+		return float64(cur - prev)
+	}
+
+	stats.BitrateIn = delta(cur.rtc.BytesReceived, prev.rtc.BytesReceived) * 8 / elapsed
+	stats.BitrateOut = delta(cur.rtc.BytesSent, prev.rtc.BytesSent) * 8 / elapsed
+	stats.FramerateIn = delta(cur.frames, prev.frames) / elapsed
+
+	received := delta(cur.rtc.PacketsReceived, prev.rtc.PacketsReceived)
+	lost := float64(cur.rtc.PacketsLost - prev.rtc.PacketsLost)
+	if lost < 0 || cur.rtc.PacketsReceived < prev.rtc.PacketsReceived {
+		lost = max(float64(cur.rtc.PacketsLost), 0)
+	}
+	if received+lost > 0 {
+		stats.PacketLossIn = lost / (received + lost)
+	}
+
+	return stats
+}
+
+func (r *Room) statsMessage() core.Message {
+	content, _ := json.Marshal(r.AllParticipantStats())
+	return core.Message{
+		Type:    "stats",
+		Content: string(content),
+	}
+}
+
+// GetParticipantStats returns the latest stats of a participant. The stats are
+// zero until the participant has a peer connection and one interval passed.
+func (r *Room) GetParticipantStats(participantID string) (ParticipantStats, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.Participants[participantID]
+	if !ok {
+		return ParticipantStats{}, false
+	}
+	stats := p.stats
+	stats.ParticipantID = p.ID
+	return stats, true
+}
+
+func (r *Room) AllParticipantStats() []ParticipantStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	all := make([]ParticipantStats, 0, len(r.Participants))
+	for _, p := range r.Participants {
+		if p.rtcConn == nil {
+			continue
+		}
+		stats := p.stats
+		stats.ParticipantID = p.ID
+		all = append(all, stats)
+	}
+	return all
+}
+
+// SetStatsSubscription turns the periodic stats stream on or off for a
+// participant allowed to moderate the room.
+func (r *Room) SetStatsSubscription(p *Participant, subscribed bool, logger *zerolog.Logger) error {
+	if _, permissions := p.access(); !permissions.CanModerate {
+		return ErrNotHost
+	}
+
+	r.mu.Lock()
+	p.statsSubscribed = subscribed
+	r.mu.Unlock()
+
+	logger.Info().Str("room_id", r.ID).Str("participant_id", p.ID).Bool("subscribed", subscribed).Msg("stats subscription changed")
+
+	if subscribed {
+		return r.SendBack(p.ID, r.statsMessage(), logger)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package streaming
+
+import (
+	"errors"
+	"sync"
+)
+
+const DefaultTenantID = "default"
+
+var (
+	ErrRoomQuotaExceeded        = errors.New("tenant room quota exceeded")
+	ErrParticipantQuotaExceeded = errors.New("tenant participant quota exceeded")
+)
+
+// TenantLimits caps how many rooms and concurrent participants a tenant may
+// have. Zero means unlimited.
+type TenantLimits struct {
+	MaxRooms        int
+	MaxParticipants int
+}
+
+type tenantUsage struct {
+	id           string
+	limits       TenantLimits
+	rooms        int
+	participants int
+	mu           sync.Mutex
+}
+
+func (t *tenantUsage) acquireRoom() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.limits.MaxRooms > 0 && t.rooms >= t.limits.MaxRooms {
+		return ErrRoomQuotaExceeded
+	}
+	t.rooms++
+	return nil
+}
+
+func (t *tenantUsage) releaseRoom() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rooms > 0 {
+		t.rooms--
+	}
+}
+
+func (t *tenantUsage) acquireParticipant() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.limits.MaxParticipants > 0 && t.participants >= t.limits.MaxParticipants {
+		return ErrParticipantQuotaExceeded
+	}
+	t.participants++
+	return nil
+}
+
+func (t *tenantUsage) releaseParticipant() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.participants > 0 {
+		t.participants--
+	}
+}
+
+func (t *tenantUsage) hasParticipantCapacity() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limits.MaxParticipants == 0 || t.participants < t.limits.MaxParticipants
+}
+
+// SetTenantLimits registers a tenant's quotas. Existing usage is kept so limits
+// can be changed while rooms are running.
+func (rm *RoomManager) SetTenantLimits(tenantID string, limits TenantLimits) {
+	rm.mu.Lock()
+	usage := rm.tenantLocked(tenantID)
+	rm.mu.Unlock()
+
+	usage.mu.Lock()
+	usage.limits = limits
+	usage.mu.Unlock()
+}
+
+// ReplaceTenantLimits sets the quotas of every tenant in limits. Tenants left
+// out become unlimited again, like tenants that were never configured.
+func (rm *RoomManager) ReplaceTenantLimits(limits map[string]TenantLimits) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	for tenantID := range limits {
+		rm.tenantLocked(tenantID)
+	}
+	for tenantID, usage := range rm.tenants {
+		usage.mu.Lock()
+		usage.limits = limits[tenantID]
+		usage.mu.Unlock()
+	}
+}
+
+// tenantLocked returns the usage record for tenantID, creating an unlimited one
+// if needed. The caller must hold rm.mu.
+func (rm *RoomManager) tenantLocked(tenantID string) *tenantUsage {
+	usage, ok := rm.tenants[tenantID]
+	if !ok {
+		usage = &tenantUsage{id: tenantID}
+		rm.tenants[tenantID] = usage
+	}
+	return usage
+}
+
+// GetTenantRoom returns the room only if it belongs to tenantID.
+func (rm *RoomManager) GetTenantRoom(tenantID string, roomID string) (*Room, bool) {
+	room, ok := rm.GetRoom(roomID)
+	if !ok || room.TenantID != tenantID {
+		return nil, false
+	}
+	return room, true
+}
+
+func (rm *RoomManager) ListTenantRooms(tenantID string) []*Room {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	rooms := make([]*Room, 0)
+	for _, room := range rm.Rooms {
+		if room.TenantID == tenantID {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms
+}
+
+// HasParticipantCapacity reports whether the room's tenant can take another
+// participant.
+func (r *Room) HasParticipantCapacity() bool {
+	return r.tenant.hasParticipantCapacity()
+}
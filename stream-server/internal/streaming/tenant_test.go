@@ -0,0 +1,36 @@
+package streaming
+
+import (
+	"errors"
+	"testing"
+
+	"stream-server/internal/rtc"
+
+	"github.com/rs/zerolog"
+)
+
+func TestReplaceTenantLimitsResetsRemovedTenants(t *testing.T) {
+	logger := zerolog.Nop()
+	rm := NewRoomManager(&logger, rtc.DefaultConfig(), DefaultRoomPolicy())
+	t.Cleanup(rm.CloseAllRooms)
+
+	rm.ReplaceTenantLimits(map[string]TenantLimits{
+		"acme":   {MaxRooms: 1},
+		"globex": {MaxRooms: 1},
+	})
+	for _, tenantID := range []string{"acme", "globex"} {
+		if _, _, err := rm.CreateRoom(tenantID+"-1", "Room", "host", tenantID, RoomPolicy{}); err != nil {
+			t.Fatalf("CreateRoom(%s): %v", tenantID, err)
+		}
+	}
+
+	// globex was removed from the key file.
+	rm.ReplaceTenantLimits(map[string]TenantLimits{"acme": {MaxRooms: 1}})
+
+	if _, _, err := rm.CreateRoom("acme-2", "Room", "host", "acme", RoomPolicy{}); !errors.Is(err, ErrRoomQuotaExceeded) {
+		t.Errorf("CreateRoom for acme = %v, want %v", err, ErrRoomQuotaExceeded)
+	}
+	if _, _, err := rm.CreateRoom("globex-2", "Room", "host", "globex", RoomPolicy{}); err != nil {
+		t.Errorf("CreateRoom for removed tenant kept its old quota: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"stream-server/internal/core"
+	"stream-server/internal/rtc"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// scriptConn returns the queued messages and then fails, like a client that
+// sends them and disconnects.
+type scriptConn struct {
+	msgs chan []byte
+}
+
+func (c *scriptConn) Send([]byte) error { return nil }
+func (c *scriptConn) Close()            {}
+func (c *scriptConn) Read() ([]byte, error) {
+	msg, ok := <-c.msgs
+	if !ok {
+		return nil, errors.New("closed")
+	}
+	return msg, nil
+}
+
+func TestSignalingSpansContinueConnectionTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	logger := zerolog.Nop()
+	rm := NewRoomManager(&logger, rtc.DefaultConfig(), DefaultRoomPolicy())
+	t.Cleanup(rm.CloseAllRooms)
+	room, _, err := rm.CreateRoom("room-1", "Room", "host", "default", RoomPolicy{})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	conn := &scriptConn{msgs: make(chan []byte, 1)}
+	conn.msgs <- []byte(`{"type":"get_participants"}`)
+	close(conn.msgs)
+	p := &Participant{
+		ID:          "alice",
+		Role:        core.RoleGuest,
+		Permissions: room.PermissionsForRole(core.RoleGuest),
+		Conn:        conn,
+		Room:        room,
+		SendChan:    make(chan core.Message, 16),
+		JoinedAt:    time.Now(),
+	}
+	if err := room.AddParticipant(p, &logger); err != nil {
+		t.Fatalf("AddParticipant: %v", err)
+	}
+
+	ctx, upgrade := otel.Tracer("test").Start(context.Background(), "websocket.Upgrade")
+	upgrade.End()
+	p.ReadPump(ctx, room, rm, &logger)
+
+	for _, span := range recorder.Ended() {
+		if span.Name() != "signaling.get_participants" {
+			continue
+		}
+		if span.Parent().SpanID() != upgrade.SpanContext().SpanID() || span.SpanContext().TraceID() != upgrade.SpanContext().TraceID() {
+			t.Errorf("signaling span parent = %v, want the upgrade span", span.Parent())
+		}
+		return
+	}
+	t.Fatal("no span recorded for the signaling message")
+}
@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is an OTLP/HTTP collector stand-in that keeps the spans it
+// receives.
+type collector struct {
+	server *httptest.Server
+	spans  []*tracepb.Span
+	mu     sync.Mutex
+}
+
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	c := &collector{}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req collectortrace.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		c.mu.Lock()
+		for _, resourceSpans := range req.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				c.spans = append(c.spans, scopeSpans.Spans...)
+			}
+		}
+		c.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		out, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+		w.Write(out)
+	}))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+func (c *collector) span(name string) *tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, span := range c.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func initCollector(t *testing.T) (*collector, func(context.Context) error) {
+	t.Helper()
+	c := newCollector(t)
+	shutdown, err := Init(context.Background(), Config{
+		Endpoint:    strings.TrimPrefix(c.server.URL, "http://"),
+		Insecure:    true,
+		ServiceName: "stream-server-test",
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return c, shutdown
+}
+
+func TestExportToCollector(t *testing.T) {
+	c, shutdown := initCollector(t)
+
+	ctx, parent := Start(context.Background(), "websocket.Upgrade")
+	_, child := Start(ctx, "signaling.sdp")
+	child.End()
+	parent.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	exportedParent, exportedChild := c.span("websocket.Upgrade"), c.span("signaling.sdp")
+	if exportedParent == nil || exportedChild == nil {
+		t.Fatalf("collector got %d spans, want the parent and the child", len(c.spans))
+	}
+	if !bytes.Equal(exportedChild.TraceId, exportedParent.TraceId) || !bytes.Equal(exportedChild.ParentSpanId, exportedParent.SpanId) {
+		t.Error("child span was not exported as a child of the parent")
+	}
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	c, shutdown := initCollector(t)
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "api.JoinRoom")
+		span.End()
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/rooms/room-1/join", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	span := c.span("api.JoinRoom")
+	if span == nil {
+		t.Fatal("collector did not receive the handler span")
+	}
+	if got := trace.TraceID(span.TraceId).String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id = %s, want the caller's", got)
+	}
+	if got := trace.SpanID(span.ParentSpanId).String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span id = %s, want the caller's", got)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	if got := Logger(context.Background(), &logger); got != &logger {
+		t.Error("Logger changed the logger for a context without a span")
+	}
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	Logger(ctx, &logger).Info().Msg("hello")
+
+	if out := buf.String(); !strings.Contains(out, `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`) || !strings.Contains(out, `"span_id":"00f067aa0ba902b7"`) {
+		t.Errorf("log line %s lacks the trace fields", out)
+	}
+}
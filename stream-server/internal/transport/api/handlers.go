@@ -1,16 +1,31 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"stream-server/internal/auth"
+	"stream-server/internal/core"
+	"stream-server/internal/storage"
 	"stream-server/internal/streaming"
+	"stream-server/internal/tracing"
+	"stream-server/internal/turnserver"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func CreateRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
+// CreateRoomHandler persists new rooms to store when it is not nil.
+func CreateRoomHandler(rm *streaming.RoomManager, store storage.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateRoomRequest
 
-		logger := rm.GetLogger()
+		ctx, span := tracing.Start(r.Context(), "api.CreateRoom")
+		defer span.End()
+		logger := tracing.Logger(ctx, rm.GetLogger())
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			logger.Warn().
 				Err(err).
@@ -32,28 +47,63 @@ func CreateRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
 			return
 		}
 
+		policy := streaming.RoomPolicy{
+			MaxDuration: time.Duration(req.MaxDurationSeconds) * time.Second,
+			Lobby:       req.Lobby,
+			Access: streaming.AccessPolicy{
+				Passcode:     req.Passcode,
+				InviteOnly:   req.InviteOnly,
+				InvitedUsers: req.InvitedUsers,
+			},
+			RoleCapacity:    req.RoleCapacity,
+			RolePermissions: req.RolePermissions,
+		}
+		if req.EmptyTimeoutSeconds != nil {
+			emptyTimeout := time.Duration(*req.EmptyTimeoutSeconds) * time.Second
+			policy.EmptyTimeout = &emptyTimeout
+		}
+		if req.ScheduledStart != nil {
+			policy.ScheduledStart = *req.ScheduledStart
+		}
+		if req.ScheduledEnd != nil {
+			policy.ScheduledEnd = *req.ScheduledEnd
+		}
+
+		if err := policy.Validate(); err != nil {
+			logger.Warn().
+				Err(err).
+				Str("userId", req.UserId).
+				Str("remote_addr", r.RemoteAddr).
+				Msg("create room request has invalid lifecycle policy")
+			http.Error(w, "Invalid room policy: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		var roomID string
+		var room *streaming.Room
 		for {
 			roomID = rm.GenerateRoomID(8)
 
-			if _, exists := rm.CreateRoom(roomID, req.Name, req.UserId); !exists {
+			created, exists, err := rm.CreateRoom(roomID, req.Name, req.UserId, tenantID(r), policy)
+			if err != nil {
+				logger.Warn().
+					Err(err).
+					Str("tenant_id", tenantID(r)).
+					Str("remote_addr", r.RemoteAddr).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Msg("room creation rejected")
+				http.Error(w, err.Error(), createRoomStatus(err))
+				return
+			}
+			if !exists {
+				room = created
 				break
 			}
 		}
 
-		room, exist := rm.GetRoom(roomID)
-
-		if !exist {
+		span.SetAttributes(attribute.String("room_id", roomID), attribute.String("tenant_id", room.TenantID))
 
-			logger.Error().
-				Str("roomId", roomID).
-				Str("remote_addr", r.RemoteAddr).
-				Str("method", r.Method).
-				Str("path", r.URL.Path).
-				Msg("failed to retrieve newly created room")
-			http.Error(w, "Fail to create room", http.StatusInternalServerError)
-			return
-		}
 		logger.Info().
 			Str("roomId", roomID).
 			Str("remote_addr", r.RemoteAddr).
@@ -61,12 +111,13 @@ func CreateRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
 			Str("path", r.URL.Path).
 			Str("creator_user_id", req.UserId).
 			Str("creator_name", req.Name).
-			Time("created_at", rm.Rooms[roomID].CreatedAt).
+			Str("tenant_id", room.TenantID).
+			Time("created_at", room.CreatedAt).
 			Int("http_status", http.StatusOK).
 			Msg("room creation request succeeded")
 
 		httpScheme := "http"
-		if r.TLS != nil {
+		if isSecure(r) {
 			httpScheme = "https"
 		}
 
@@ -74,6 +125,49 @@ func CreateRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
 		audienceURL := httpScheme + "://" + r.Host + "/join/" + room.ID + "?role=audience"
 		hostURL := httpScheme + "://" + r.Host + "/join/" + room.ID + "?role=host"
 
+		hostKey, err := room.IssueHostKey()
+		if err != nil {
+			logger.Error().Err(err).Str("roomId", roomID).Msg("failed to issue host key")
+			rm.DeleteRoom(roomID)
+			http.Error(w, "Fail to create room", http.StatusInternalServerError)
+			return
+		}
+
+		if room.IsProtected() {
+			inviteTTL := time.Duration(req.InviteTTLSeconds) * time.Second
+			if inviteTTL <= 0 {
+				inviteTTL = defaultInviteTTL
+			}
+
+			guestInvite, err := room.CreateInvite("guest", inviteTTL, req.SingleUseInvites)
+			if err == nil {
+				var audienceInvite streaming.Invite
+				audienceInvite, err = room.CreateInvite("audience", inviteTTL, req.SingleUseInvites)
+				guestURL += "&invite=" + url.QueryEscape(guestInvite.Code)
+				audienceURL += "&invite=" + url.QueryEscape(audienceInvite.Code)
+			}
+			if err != nil {
+				logger.Error().Err(err).Str("roomId", roomID).Msg("failed to create invite codes")
+				rm.DeleteRoom(roomID)
+				http.Error(w, "Fail to create room", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if store != nil {
+			if err := store.SaveRoom(ctx, storage.NewRoom(room)); err != nil {
+				logger.Error().Err(err).Str("roomId", roomID).Msg("failed to persist room")
+				rm.DeleteRoom(roomID)
+				http.Error(w, "Fail to create room", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		var closesAt string
+		if t := room.ClosesAt(); !t.IsZero() {
+			closesAt = t.Format(timeLayout)
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(CreateRoomResponse{
 			Name:        room.Name,
@@ -82,15 +176,22 @@ func CreateRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
 			HostURL:     hostURL,
 			GuestURL:    guestURL,
 			AudienceURL: audienceURL,
-			CreatedAt:   rm.Rooms[roomID].CreatedAt.Format(`2006-01-02 15:04:05`),
+			CreatedAt:   room.CreatedAt.Format(timeLayout),
 			CreatedBy:   room.CreatedBy,
+			ClosesAt:    closesAt,
+			Protected:   room.IsProtected(),
+			HostKey:     hostKey,
 		})
 	}
 }
 
-func JoinRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
+// JoinRoomHandler restores rooms from store, when it is not nil, that were
+// open when the server last stopped.
+func JoinRoomHandler(rm *streaming.RoomManager, tokens *auth.TokenIssuer, relay *turnserver.Server, store storage.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger := rm.GetLogger()
+		ctx, span := tracing.Start(r.Context(), "api.JoinRoom")
+		defer span.End()
+		logger := tracing.Logger(ctx, rm.GetLogger())
 
 		var req JoinRoomRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -114,7 +215,7 @@ func JoinRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
 			return
 		}
 
-		if req.Role != "host" && req.Role != "guest" && req.Role != "audience" {
+		if !core.IsValidRole(req.Role) {
 			logger.Warn().
 				Str("userId", req.UserID).
 				Str("roomId", req.RoomID).
@@ -124,51 +225,165 @@ func JoinRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
 			return
 		}
 
+		// Participants joining now would keep the drain from finishing.
+		if rm.IsDraining() {
+			logger.Warn().
+				Str("userId", req.UserID).
+				Str("roomId", req.RoomID).
+				Msg("join room request rejected, server is draining")
+			http.Error(w, "Server is draining, join another node", http.StatusServiceUnavailable)
+			return
+		}
+
 		userId := req.UserID
 		roomId := req.RoomID
 		role := req.Role
+		span.SetAttributes(
+			attribute.String("room_id", roomId),
+			attribute.String("user_id", userId),
+			attribute.String("role", role),
+		)
 
 		room, ok := rm.GetRoom(roomId)
-		if !ok {
+		if !ok && store != nil {
+			var err error
+			if room, ok, err = restoreRoom(ctx, rm, store, tenantID(r), roomId); err != nil {
+				logger.Error().
+					Err(err).
+					Str("roomId", roomId).
+					Msg("failed to restore room")
+				status := http.StatusServiceUnavailable
+				if errors.Is(err, streaming.ErrRoomQuotaExceeded) {
+					status = http.StatusTooManyRequests
+				}
+				http.Error(w, "Failed to restore room", status)
+				return
+			}
+		}
+		// Rooms of other tenants are reported as missing.
+		if !ok || room.TenantID != tenantID(r) {
 			logger.Warn().
 				Str("user_id", userId).
 				Str("room_id", roomId).
+				Str("tenant_id", tenantID(r)).
 				Msg("attempt to join non-existent room")
 			http.Error(w, "Room does not exist", http.StatusBadRequest)
 			return
 		}
 
-		switch role {
-		case "host":
-			if room.CreatedBy != req.UserID {
-				logger.Warn().
-					Str("roomId", roomId).
-					Str("userId", userId).
-					Msg("Invalid request to join room as host")
-				http.Error(w, "Invalid request to join room as host", http.StatusForbidden)
-				return
+		if !room.HasParticipantCapacity() {
+			logger.Warn().
+				Str("roomId", roomId).
+				Str("userId", userId).
+				Str("tenant_id", room.TenantID).
+				Msg("tenant participant quota exceeded")
+			http.Error(w, streaming.ErrParticipantQuotaExceeded.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		if room.IsBanned(userId) {
+			logger.Warn().
+				Str("roomId", roomId).
+				Str("userId", userId).
+				Msg("banned user attempted to join room")
+			http.Error(w, "You have been banned from this room", http.StatusForbidden)
+			return
+		}
+
+		credentials := streaming.Credentials{
+			Passcode:   req.Passcode,
+			InviteCode: req.InviteCode,
+			HostKey:    req.HostKey,
+		}
+		if err := room.CheckAccess(userId, role, credentials); err != nil {
+			logger.Warn().
+				Err(err).
+				Str("roomId", roomId).
+				Str("userId", userId).
+				Str("role", role).
+				Msg("join room request denied by access policy")
+			status := http.StatusForbidden
+			if errors.Is(err, streaming.ErrPasscodeRequired) || errors.Is(err, streaming.ErrInvalidPasscode) {
+				status = http.StatusUnauthorized
 			}
-		case "guest":
-			if len(room.Participants) >= 2 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		if role != "host" && !room.HasStarted(time.Now()) {
+			logger.Warn().
+				Str("roomId", roomId).
+				Str("userId", userId).
+				Msg("attempt to join room before its scheduled start")
+			http.Error(w, "Room has not started yet", http.StatusForbidden)
+			return
+		}
+
+		if err := room.CheckRoleCapacity(role); err != nil {
+			logger.Warn().
+				Str("roomId", roomId).
+				Str("userId", userId).
+				Str("role", role).
+				Msg("room is full for role")
+			http.Error(w, "Room is full", http.StatusForbidden)
+			return
+		}
+
+		wsBase := "ws://" + r.Host
+		if isSecure(r) {
+			wsBase = "wss://" + r.Host
+		}
+		// In a cluster the client must reach this node, not the load balancer,
+		// unless the room has outgrown it and the client joins through an edge.
+		nodeURL := rm.Node().URL
+		if edge, ok := rm.EdgeNode(r.Context(), room); ok {
+			logger.Debug().
+				Str("roomId", roomId).
+				Str("userId", userId).
+				Str("edge_node", edge.ID).
+				Msg("sending participant to edge node")
+			nodeURL = edge.URL
+		}
+		if nodeURL != "" {
+			wsBase = strings.TrimSuffix(nodeURL, "/")
+			wsBase = strings.Replace(wsBase, "http", "ws", 1)
+		}
+
+		token, claims, err := tokens.Issue(roomId, room.TenantID, userId, role, room.PermissionsForRole(role))
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Str("roomId", roomId).
+				Str("userId", userId).
+				Msg("failed to issue join token")
+			http.Error(w, "Failed to issue join token", http.StatusInternalServerError)
+			return
+		}
+
+		if req.InviteCode != "" {
+			if err := room.ConsumeInvite(req.InviteCode, role); err != nil {
 				logger.Warn().
 					Str("roomId", roomId).
 					Str("userId", userId).
-					Msg("room is full for guests")
-				http.Error(w, "Room is full", http.StatusForbidden)
+					Msg("invite code was used up by a concurrent join")
+				http.Error(w, err.Error(), http.StatusForbidden)
 				return
 			}
-		case "audience":
-
 		}
 
-		wsScheme := "ws"
-		if r.TLS != nil {
-			wsScheme = "wss"
-		}
+		wsURL := wsBase + "/rooms" + "/" + roomId +
+			"/ws?token=" + url.QueryEscape(token)
 
-		wsURL := wsScheme + "://" + r.Host + "/rooms" + "/" + roomId +
-			"/ws?userId=" + userId +
-			"&role=" + role
+		var iceServers []ICEServerResponse
+		if relay != nil {
+			credentials := relay.Credentials(userId)
+			iceServers = append(iceServers, ICEServerResponse{
+				URLs:       credentials.URLs,
+				Username:   credentials.Username,
+				Credential: credentials.Credential,
+				ExpiresAt:  credentials.ExpiresAt.Format(timeLayout),
+			})
+		}
 
 		logger.Info().
 			Str("roomId", roomId).
@@ -182,14 +397,60 @@ func JoinRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(JoinRoomResponse{
-			Name:      room.Name,
-			Status:    "connecting",
-			UserID:    userId,
-			Role:      role,
-			RoomID:    roomId,
-			WSURL:     wsURL,
-			CreatedAt: room.CreatedAt.Format(`2006-01-02 15:04:05`),
-			CreatedBy: room.CreatedBy,
+			Name:       room.Name,
+			Status:     "connecting",
+			UserID:     userId,
+			Role:       role,
+			RoomID:     roomId,
+			WSURL:      wsURL,
+			Token:      token,
+			ExpiresAt:  time.Unix(claims.ExpiresAt, 0).Format(timeLayout),
+			CreatedAt:  room.CreatedAt.Format(timeLayout),
+			ICEServers: iceServers,
 		})
 	}
 }
+
+// createRoomStatus maps a CreateRoom error to a status code. Only an exceeded
+// quota is the caller's to retry later; the others are on our side.
+func createRoomStatus(err error) int {
+	switch {
+	case errors.Is(err, streaming.ErrRoomQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, streaming.ErrDraining), errors.Is(err, streaming.ErrDirectoryUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// restoreRoom recreates a stored room of tenantID that is still open. Rooms
+// that were closed, belong to another tenant, or that another node restored
+// first, are reported as not found.
+func restoreRoom(ctx context.Context, rm *streaming.RoomManager, store storage.Store, tenantID string, roomID string) (*streaming.Room, bool, error) {
+	stored, err := store.GetRoom(ctx, roomID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !stored.ClosedAt.IsZero() || stored.TenantID != tenantID {
+		return nil, false, nil
+	}
+
+	room, _, err := rm.RestoreRoom(stored.ID, stored.Name, stored.CreatedBy, stored.TenantID, stored.CreatedAt, stored.RoomPolicy(), stored.Bans)
+	if err != nil {
+		return nil, false, err
+	}
+	if room == nil {
+		return nil, false, nil
+	}
+
+	rm.GetLogger().Info().
+		Str("roomId", roomID).
+		Str("tenant_id", stored.TenantID).
+		Time("created_at", stored.CreatedAt).
+		Msg("room restored from storage")
+	return room, true, nil
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"stream-server/internal/auth"
+	"stream-server/internal/directory"
+	"stream-server/internal/rtc"
+	"stream-server/internal/streaming"
+
+	"github.com/rs/zerolog"
+)
+
+// failingDirectory cannot be reached, like a redis server that is down.
+type failingDirectory struct {
+	*directory.Memory
+}
+
+func (failingDirectory) Claim(context.Context, directory.Entry) (directory.Entry, bool, error) {
+	return directory.Entry{}, false, errors.New("connection refused")
+}
+
+func TestCreateRoomStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(rm *streaming.RoomManager)
+		want  int
+	}{
+		{"created", func(rm *streaming.RoomManager) {}, http.StatusOK},
+		{"room quota", func(rm *streaming.RoomManager) {
+			rm.SetTenantLimits(streaming.DefaultTenantID, streaming.TenantLimits{MaxRooms: 1})
+			rm.CreateRoom("existing", "Existing", "host", streaming.DefaultTenantID, streaming.RoomPolicy{})
+		}, http.StatusTooManyRequests},
+		{"draining", func(rm *streaming.RoomManager) { rm.StartDrain("test") }, http.StatusServiceUnavailable},
+		{"directory down", func(rm *streaming.RoomManager) {
+			rm.SetDirectory(failingDirectory{directory.NewMemory()}, streaming.Node{ID: "node-1"})
+		}, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.Nop()
+			rm := streaming.NewRoomManager(&logger, rtc.DefaultConfig(), streaming.DefaultRoomPolicy())
+			t.Cleanup(rm.CloseAllRooms)
+			tt.setup(rm)
+
+			body := `{"userId":"host","userName":"Host","name":"Room"}`
+			rec := httptest.NewRecorder()
+			CreateRoomHandler(rm, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rooms", strings.NewReader(body)))
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d (%s), want %d", rec.Code, strings.TrimSpace(rec.Body.String()), tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinRejectedWhileDraining(t *testing.T) {
+	logger := zerolog.Nop()
+	rm := streaming.NewRoomManager(&logger, rtc.DefaultConfig(), streaming.DefaultRoomPolicy())
+	t.Cleanup(rm.CloseAllRooms)
+	if _, _, err := rm.CreateRoom("room-1", "Room", "host", streaming.DefaultTenantID, streaming.RoomPolicy{}); err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	rm.StartDrain("test")
+
+	body := `{"userId":"alice","roomId":"room-1","role":"guest"}`
+	rec := httptest.NewRecorder()
+	JoinRoomHandler(rm, auth.NewTokenIssuer([]byte("secret"), time.Minute), nil, nil).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rooms/room-1/join", strings.NewReader(body)))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"stream-server/internal/streaming"
+)
+
+// HealthzHandler reports that the process is up. It does not depend on room
+// state so a draining node stays live.
+func HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok"))
+	}
+}
+
+// ReadyzHandler reports whether the node accepts new rooms.
+func ReadyzHandler(rm *streaming.RoomManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rm.IsDraining() {
+			http.Error(w, "draining", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ready"))
+	}
+}
+
+// DrainHandler stops new room creation and notifies participants. It returns
+// immediately; StopServer waits for the rooms to empty.
+func DrainHandler(rm *streaming.RoomManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := rm.GetLogger()
+
+		started := rm.StartDrain("maintenance")
+
+		rooms := rm.ListRooms()
+		participants := 0
+		for _, room := range rooms {
+			participants += room.GetParticipantCount()
+		}
+
+		logger.Info().
+			Bool("already_draining", !started).
+			Int("rooms", len(rooms)).
+			Int("participants", participants).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("drain requested")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(DrainResponse{
+			Draining:     true,
+			Rooms:        len(rooms),
+			Participants: participants,
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"stream-server/internal/storage"
+	"stream-server/internal/streaming"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultInviteTTL = 24 * time.Hour
+
+func CreateInviteHandler(rm *streaming.RoomManager, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := rm.GetLogger()
+		roomId := chi.URLParam(r, "roomId")
+
+		room, ok := rm.GetRoom(roomId)
+		if !ok {
+			http.Error(w, "Room does not exist", http.StatusNotFound)
+			return
+		}
+
+		var req CreateInviteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Warn().
+				Err(err).
+				Str("remote_addr", r.RemoteAddr).
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Msg("failed to decode create invite request body")
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		ttl := time.Duration(req.TTLSeconds) * time.Second
+		if ttl <= 0 {
+			ttl = defaultInviteTTL
+		}
+
+		invite, err := room.CreateInvite(req.Role, ttl, req.SingleUse)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		saveRoom(r.Context(), store, room, logger)
+
+		httpScheme := "http"
+		if isSecure(r) {
+			httpScheme = "https"
+		}
+
+		logger.Info().
+			Str("roomId", roomId).
+			Str("role", invite.Role).
+			Bool("single_use", invite.SingleUse).
+			Time("expires_at", invite.ExpiresAt).
+			Msg("invite created")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(InviteResponse{
+			Code:      invite.Code,
+			Role:      invite.Role,
+			URL:       httpScheme + "://" + r.Host + "/join/" + room.ID + "?role=" + invite.Role + "&invite=" + url.QueryEscape(invite.Code),
+			SingleUse: invite.SingleUse,
+			ExpiresAt: formatOptionalTime(invite.ExpiresAt),
+		})
+	}
+}
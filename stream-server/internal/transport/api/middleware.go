@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/netip"
+	"stream-server/internal/auth"
+	"stream-server/internal/streaming"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RequireRoomToken rejects requests without a valid bearer token for the room
+// in the URL and its tenant that grants permission. The verified claims are
+// stored in the request context.
+func RequireRoomToken(rm *streaming.RoomManager, tokens *auth.TokenIssuer, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := rm.GetLogger()
+			roomId := chi.URLParam(r, "roomId")
+
+			claims, err := tokens.Verify(auth.BearerToken(r.Header.Get("Authorization")))
+			if err != nil {
+				logger.Warn().
+					Err(err).
+					Str("roomId", roomId).
+					Str("remote_addr", r.RemoteAddr).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Msg("request with invalid room token")
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+
+			// A room id reused by another tenant does not accept old tokens.
+			room, ok := rm.GetRoom(roomId)
+			sameTenant := !ok || room.TenantID == claims.TenantID
+			if claims.RoomID != roomId || !sameTenant || !claims.HasPermission(permission) {
+				logger.Warn().
+					Str("roomId", roomId).
+					Str("token_room_id", claims.RoomID).
+					Str("userId", claims.UserID).
+					Str("permission", permission).
+					Str("path", r.URL.Path).
+					Msg("room token does not grant required permission")
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// RequireAPIKey resolves the caller's tenant from the X-API-Key header. When no
+// key store is configured every request belongs to the default tenant.
+func RequireAPIKey(rm *streaming.RoomManager, keys *auth.APIKeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if keys == nil {
+				next.ServeHTTP(w, r.WithContext(auth.WithTenant(r.Context(), streaming.DefaultTenantID)))
+				return
+			}
+
+			tenant, ok := keys.Lookup(r.Header.Get("X-API-Key"))
+			if !ok {
+				rm.GetLogger().Warn().
+					Str("remote_addr", r.RemoteAddr).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Msg("request with missing or unknown API key")
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithTenant(r.Context(), tenant.ID)))
+		})
+	}
+}
+
+// RequireAPIKeyOrRoomToken accepts the API key of the room's tenant as well as
+// a room token that grants permission, so tenants can manage their rooms
+// without holding a host token. Requests without an API key, or on servers
+// without a key store, need the room token.
+func RequireAPIKeyOrRoomToken(rm *streaming.RoomManager, keys *auth.APIKeyStore, tokens *auth.TokenIssuer, permission string) func(http.Handler) http.Handler {
+	roomToken := RequireRoomToken(rm, tokens, permission)
+	return func(next http.Handler) http.Handler {
+		withRoomToken := roomToken(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-API-Key")
+			if keys == nil || key == "" {
+				withRoomToken.ServeHTTP(w, r)
+				return
+			}
+
+			tenant, ok := keys.Lookup(key)
+			if !ok {
+				rm.GetLogger().Warn().
+					Str("remote_addr", r.RemoteAddr).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Msg("request with unknown API key")
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+
+			if _, ok := rm.GetTenantRoom(tenant.ID, chi.URLParam(r, "roomId")); !ok {
+				http.Error(w, "Room does not exist", http.StatusNotFound)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithTenant(r.Context(), tenant.ID)))
+		})
+	}
+}
+
+func tenantID(r *http.Request) string {
+	if tenantID, ok := auth.TenantFromContext(r.Context()); ok {
+		return tenantID
+	}
+	return streaming.DefaultTenantID
+}
+
+// RequireAdmin guards node administration routes with a static bearer token,
+// a verified client certificate, or both when both are configured. Admin
+// routes are disabled when neither is.
+func RequireAdmin(rm *streaming.RoomManager, token string, requireClientCert bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" && !requireClientCert {
+				http.Error(w, "Admin API is disabled", http.StatusForbidden)
+				return
+			}
+
+			if requireClientCert && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+				rm.GetLogger().Warn().
+					Str("remote_addr", r.RemoteAddr).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Msg("admin request without a verified client certificate")
+				http.Error(w, "Client certificate required", http.StatusForbidden)
+				return
+			}
+
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			presented := auth.BearerToken(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				rm.GetLogger().Warn().
+					Str("remote_addr", r.RemoteAddr).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Msg("admin request with invalid token")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type contextKey string
+
+const forwardedProtoKey contextKey = "forwarded_proto"
+
+// ForwardedProto records X-Forwarded-Proto when the request comes directly
+// from one of the trusted proxies. The header is ignored otherwise.
+func ForwardedProto(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("X-Forwarded-Proto")
+			if header == "" || len(trusted) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			addr := addrPort.Addr().Unmap()
+			for _, prefix := range trusted {
+				if prefix.Contains(addr) {
+					// A chain of proxies appends; the first entry is the client's.
+					proto, _, _ := strings.Cut(header, ",")
+					proto = strings.ToLower(strings.TrimSpace(proto))
+					r = r.WithContext(context.WithValue(r.Context(), forwardedProtoKey, proto))
+					break
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isSecure reports whether the client reached us over TLS, either directly or
+// through a trusted proxy.
+func isSecure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	proto, _ := r.Context().Value(forwardedProtoKey).(string)
+	return proto == "https" || proto == "wss"
+}
+
+// RedirectToOwner sends requests for rooms hosted on another node to that node
+// with a 307 so the method and body are preserved. Requests for local or
+// unknown rooms pass through.
+func RedirectToOwner(rm *streaming.RoomManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			roomID := chi.URLParam(r, "roomId")
+			if roomID == "" || rm.HasRoom(roomID) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			owner, ok, err := rm.LookupRemoteRoom(r.Context(), roomID)
+			if err != nil {
+				rm.GetLogger().Error().
+					Err(err).
+					Str("roomId", roomID).
+					Str("path", r.URL.Path).
+					Msg("failed to look up room owner")
+				http.Error(w, "Room directory unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			if !ok || owner.NodeURL == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rm.GetLogger().Debug().
+				Str("roomId", roomID).
+				Str("owner_node", owner.NodeID).
+				Str("path", r.URL.Path).
+				Msg("redirecting request to room owner")
+			http.Redirect(w, r, strings.TrimSuffix(owner.NodeURL, "/")+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+		})
+	}
+}
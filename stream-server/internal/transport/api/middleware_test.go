@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"stream-server/internal/auth"
+	"stream-server/internal/core"
+	"stream-server/internal/rtc"
+	"stream-server/internal/streaming"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+func TestRequireAPIKeyOrRoomToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keysFile := `{"tenants":[{"id":"acme","apiKeys":["acme-key"]},{"id":"globex","apiKeys":["globex-key"]}]}`
+	if err := os.WriteFile(path, []byte(keysFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.LoadAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyStore: %v", err)
+	}
+	tokens := auth.NewTokenIssuer([]byte("secret"), time.Minute)
+
+	logger := zerolog.Nop()
+	rm := streaming.NewRoomManager(&logger, rtc.DefaultConfig(), streaming.DefaultRoomPolicy())
+	t.Cleanup(rm.CloseAllRooms)
+	if _, _, err := rm.CreateRoom("room-1", "Room", "host", "acme", streaming.RoomPolicy{}); err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	hostToken, _, _ := tokens.Issue("room-1", "acme", "host", core.RoleHost, core.RoleTemplates[core.RoleHost])
+	guestToken, _, _ := tokens.Issue("room-1", "acme", "alice", core.RoleGuest, core.RoleTemplates[core.RoleGuest])
+
+	router := chi.NewRouter()
+	router.With(RequireAPIKeyOrRoomToken(rm, keys, tokens, core.PermissionModerate)).
+		Delete("/rooms/{roomId}", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	tests := []struct {
+		name   string
+		apiKey string
+		token  string
+		want   int
+	}{
+		{"tenant key", "acme-key", "", http.StatusNoContent},
+		{"other tenant's key", "globex-key", "", http.StatusNotFound},
+		{"unknown key", "nope", "", http.StatusUnauthorized},
+		{"host token", "", hostToken, http.StatusNoContent},
+		{"guest token", "", guestToken, http.StatusForbidden},
+		{"nothing", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/rooms/room-1", nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"stream-server/internal/streaming"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// decodeModerationRequest loads the room and request body for a request that
+// already passed RequireRoomToken with the moderate permission. It writes the
+// error response itself and returns ok=false on failure.
+func decodeModerationRequest(rm *streaming.RoomManager, w http.ResponseWriter, r *http.Request) (*streaming.Room, ModerationRequest, bool) {
+	logger := rm.GetLogger()
+	roomId := chi.URLParam(r, "roomId")
+
+	var req ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Warn().
+			Err(err).
+			Str("remote_addr", r.RemoteAddr).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Msg("failed to decode moderation request body")
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return nil, req, false
+	}
+
+	room, ok := rm.GetRoom(roomId)
+	if !ok {
+		http.Error(w, "Room does not exist", http.StatusNotFound)
+		return nil, req, false
+	}
+
+	return room, req, true
+}
+
+func KickParticipantHandler(rm *streaming.RoomManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		room, req, ok := decodeModerationRequest(rm, w, r)
+		if !ok {
+			return
+		}
+
+		participantId := chi.URLParam(r, "participantId")
+		if err := room.KickParticipant(participantId, req.Reason, rm.GetLogger()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ChangeRoleHandler(rm *streaming.RoomManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		room, req, ok := decodeModerationRequest(rm, w, r)
+		if !ok {
+			return
+		}
+
+		participantId := chi.URLParam(r, "participantId")
+		if err := room.ChangeRole(participantId, req.Role, rm.GetLogger()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func BanUserHandler(rm *streaming.RoomManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		room, req, ok := decodeModerationRequest(rm, w, r)
+		if !ok {
+			return
+		}
+
+		if req.TargetUserID == "" {
+			http.Error(w, "Missing required fields: targetUserId", http.StatusBadRequest)
+			return
+		}
+
+		if err := room.BanUser(req.TargetUserID, req.Reason, rm.GetLogger()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
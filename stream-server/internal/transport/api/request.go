@@ -1,13 +1,59 @@
 package api
 
+import (
+	"stream-server/internal/core"
+	"time"
+)
+
 type CreateRoomRequest struct {
 	UserId   string `json:"userId"`
 	UserName string `json:"userName"`
 	Name     string `json:"name"`
+	// EmptyTimeoutSeconds takes the server default when absent; 0 keeps the
+	// room open while it is empty.
+	EmptyTimeoutSeconds *int       `json:"emptyTimeoutSeconds"`
+	MaxDurationSeconds  int        `json:"maxDurationSeconds"`
+	ScheduledStart      *time.Time `json:"scheduledStart"`
+	ScheduledEnd        *time.Time `json:"scheduledEnd"`
+	Lobby               bool       `json:"lobby"`
+	Passcode            string     `json:"passcode"`
+	InviteOnly          bool       `json:"inviteOnly"`
+	InvitedUsers        []string   `json:"invitedUsers"`
+	InviteTTLSeconds    int        `json:"inviteTtlSeconds"`
+	SingleUseInvites    bool       `json:"singleUseInvites"`
+	// RoleCapacity and RolePermissions are keyed by role name.
+	RoleCapacity    map[string]int              `json:"roleCapacity"`
+	RolePermissions map[string]core.Permissions `json:"rolePermissions"`
 }
 
 type JoinRoomRequest struct {
-	UserID string `json:"userId"`
-	RoomID string `json:"roomId"`
-	Role   string `json:"role"`
+	UserID     string `json:"userId"`
+	RoomID     string `json:"roomId"`
+	Role       string `json:"role"`
+	Passcode   string `json:"passcode"`
+	InviteCode string `json:"inviteCode"`
+	// HostKey is required for the host role; it is only returned when the
+	// room is created.
+	HostKey string `json:"hostKey"`
+}
+
+type UpdateRoomRequest struct {
+	Name                *string    `json:"name"`
+	EmptyTimeoutSeconds *int       `json:"emptyTimeoutSeconds"`
+	MaxDurationSeconds  *int       `json:"maxDurationSeconds"`
+	ScheduledStart      *time.Time `json:"scheduledStart"`
+	ScheduledEnd        *time.Time `json:"scheduledEnd"`
+	Lobby               *bool      `json:"lobby"`
+}
+
+type ModerationRequest struct {
+	TargetUserID string `json:"targetUserId"`
+	Reason       string `json:"reason"`
+	Role         string `json:"role"`
+}
+
+type CreateInviteRequest struct {
+	Role       string `json:"role"`
+	TTLSeconds int    `json:"ttlSeconds"`
+	SingleUse  bool   `json:"singleUse"`
 }
@@ -1,5 +1,7 @@
 package api
 
+import "stream-server/internal/core"
+
 type CreateRoomResponse struct {
 	Name        string `json:"name"`
 	Role        string `json:"role"`
@@ -9,6 +11,10 @@ type CreateRoomResponse struct {
 	AudienceURL string `json:"audienceURL"`
 	CreatedAt   string `json:"createdAt"`
 	CreatedBy   string `json:"createdBy"`
+	ClosesAt    string `json:"closesAt,omitempty"`
+	Protected   bool   `json:"protected"`
+	// HostKey lets the creator join as host. It is not returned again.
+	HostKey string `json:"hostKey"`
 }
 
 type JoinRoomResponse struct {
@@ -18,6 +24,102 @@ type JoinRoomResponse struct {
 	Role      string `json:"role"`
 	RoomID    string `json:"roomId"`
 	WSURL     string `json:"wsURL"`
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expiresAt"`
 	CreatedAt string `json:"createdAt"`
-	CreatedBy string `json:"createdBy"`
+	// ICEServers carries relay credentials when the embedded TURN server is
+	// enabled. The entries can be passed to RTCPeerConnection as is.
+	ICEServers []ICEServerResponse `json:"iceServers,omitempty"`
+}
+
+type ICEServerResponse struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+	ExpiresAt  string   `json:"expiresAt,omitempty"`
+}
+
+type RoomPolicyResponse struct {
+	EmptyTimeoutSeconds int                         `json:"emptyTimeoutSeconds"`
+	MaxDurationSeconds  int                         `json:"maxDurationSeconds"`
+	ScheduledStart      string                      `json:"scheduledStart,omitempty"`
+	ScheduledEnd        string                      `json:"scheduledEnd,omitempty"`
+	Lobby               bool                        `json:"lobby"`
+	RoleCapacity        map[string]int              `json:"roleCapacity"`
+	RolePermissions     map[string]core.Permissions `json:"rolePermissions"`
+}
+
+type ParticipantResponse struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Status   string `json:"status"`
+	JoinedAt string `json:"joinedAt"`
+}
+
+type RoomSummaryResponse struct {
+	RoomID           string `json:"roomId"`
+	Name             string `json:"name"`
+	ParticipantCount int    `json:"participantCount"`
+	CreatedAt        string `json:"createdAt"`
+}
+
+type ListRoomsResponse struct {
+	Count int                   `json:"count"`
+	Rooms []RoomSummaryResponse `json:"rooms"`
+}
+
+type RoomResponse struct {
+	RoomID       string                       `json:"roomId"`
+	Name         string                       `json:"name"`
+	CreatedAt    string                       `json:"createdAt"`
+	ClosesAt     string                       `json:"closesAt,omitempty"`
+	Policy       RoomPolicyResponse           `json:"policy"`
+	Participants []ParticipantResponse        `json:"participants"`
+	Tracks       []core.OutgoingTrackMetaData `json:"tracks"`
+}
+
+type InviteResponse struct {
+	Code      string `json:"code"`
+	Role      string `json:"role"`
+	URL       string `json:"url"`
+	SingleUse bool   `json:"singleUse"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID          string `json:"id"`
+	Event       string `json:"event"`
+	RoomID      string `json:"roomId"`
+	URL         string `json:"url"`
+	Attempts    int    `json:"attempts"`
+	StatusCode  int    `json:"statusCode,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Succeeded   bool   `json:"succeeded"`
+	CreatedAt   string `json:"createdAt"`
+	CompletedAt string `json:"completedAt,omitempty"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Count      int                       `json:"count"`
+	Deliveries []WebhookDeliveryResponse `json:"deliveries"`
+}
+
+type ParticipantStatsResponse struct {
+	ParticipantID   string  `json:"participantId"`
+	RoundTripTimeMs float64 `json:"rttMs"`
+	JitterInMs      float64 `json:"jitterInMs"`
+	JitterOutMs     float64 `json:"jitterOutMs"`
+	PacketLossIn    float64 `json:"packetLossIn"`
+	PacketLossOut   float64 `json:"packetLossOut"`
+	BitrateIn       float64 `json:"bitrateIn"`
+	BitrateOut      float64 `json:"bitrateOut"`
+	FramerateIn     float64 `json:"framerateIn"`
+	CollectedAt     string  `json:"collectedAt,omitempty"`
+}
+
+type DrainResponse struct {
+	Draining     bool `json:"draining"`
+	Rooms        int  `json:"rooms"`
+	Participants int  `json:"participants"`
 }
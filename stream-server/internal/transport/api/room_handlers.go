@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"stream-server/internal/core"
+	"stream-server/internal/storage"
+	"stream-server/internal/streaming"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+const timeLayout = `2006-01-02 15:04:05`
+
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(timeLayout)
+}
+
+func newRoomResponse(room *streaming.Room, rm *streaming.RoomManager) RoomResponse {
+	policy := room.GetPolicy()
+
+	participants := room.ListParticipants()
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].JoinedAt < participants[j].JoinedAt
+	})
+
+	participantResponses := make([]ParticipantResponse, 0, len(participants))
+	for _, p := range participants {
+		participantResponses = append(participantResponses, ParticipantResponse{
+			ID:       p.ID,
+			Name:     p.Name,
+			Role:     p.Role,
+			Status:   p.Status,
+			JoinedAt: time.Unix(p.JoinedAt, 0).Format(timeLayout),
+		})
+	}
+
+	rolePermissions := make(map[string]core.Permissions, len(core.RoleTemplates))
+	for role := range core.RoleTemplates {
+		rolePermissions[role] = room.PermissionsForRole(role)
+	}
+
+	return RoomResponse{
+		RoomID:    room.ID,
+		Name:      room.GetName(),
+		CreatedAt: room.CreatedAt.Format(timeLayout),
+		ClosesAt:  formatOptionalTime(room.ClosesAt()),
+		Policy: RoomPolicyResponse{
+			EmptyTimeoutSeconds: int(policy.EmptyTimeoutDuration().Seconds()),
+			MaxDurationSeconds:  int(policy.MaxDuration.Seconds()),
+			ScheduledStart:      formatOptionalTime(policy.ScheduledStart),
+			ScheduledEnd:        formatOptionalTime(policy.ScheduledEnd),
+			Lobby:               policy.Lobby,
+			RoleCapacity:        policy.RoleCapacity,
+			RolePermissions:     rolePermissions,
+		},
+		Participants: participantResponses,
+		Tracks:       room.GetTracks(rm.GetLogger()),
+	}
+}
+
+// saveRoom persists a changed room definition when storage is enabled. The
+// change has already been applied, so a failure is only logged.
+func saveRoom(ctx context.Context, store storage.Store, room *streaming.Room, logger *zerolog.Logger) {
+	if store == nil {
+		return
+	}
+	if err := store.SaveRoom(ctx, storage.NewRoom(room)); err != nil {
+		logger.Error().Err(err).Str("roomId", room.ID).Msg("failed to persist room")
+	}
+}
+
+func ListRoomsHandler(rm *streaming.RoomManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rooms := rm.ListTenantRooms(tenantID(r))
+		sort.Slice(rooms, func(i, j int) bool {
+			return rooms[i].CreatedAt.Before(rooms[j].CreatedAt)
+		})
+
+		summaries := make([]RoomSummaryResponse, 0, len(rooms))
+		for _, room := range rooms {
+			summaries = append(summaries, RoomSummaryResponse{
+				RoomID:           room.ID,
+				Name:             room.GetName(),
+				ParticipantCount: room.GetParticipantCount(),
+				CreatedAt:        room.CreatedAt.Format(timeLayout),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ListRoomsResponse{
+			Count: len(summaries),
+			Rooms: summaries,
+		})
+	}
+}
+
+func GetRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomId := chi.URLParam(r, "roomId")
+
+		room, ok := rm.GetTenantRoom(tenantID(r), roomId)
+		if !ok {
+			http.Error(w, "Room does not exist", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newRoomResponse(room, rm))
+	}
+}
+
+func UpdateRoomHandler(rm *streaming.RoomManager, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := rm.GetLogger()
+		roomId := chi.URLParam(r, "roomId")
+
+		room, ok := rm.GetRoom(roomId)
+		if !ok {
+			http.Error(w, "Room does not exist", http.StatusNotFound)
+			return
+		}
+
+		var req UpdateRoomRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Warn().
+				Err(err).
+				Str("remote_addr", r.RemoteAddr).
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Msg("failed to decode update room request body")
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if req.Name != nil && *req.Name == "" {
+			http.Error(w, "Room name must not be empty", http.StatusBadRequest)
+			return
+		}
+
+		policy := room.GetPolicy()
+		if req.EmptyTimeoutSeconds != nil {
+			emptyTimeout := time.Duration(*req.EmptyTimeoutSeconds) * time.Second
+			policy.EmptyTimeout = &emptyTimeout
+		}
+		if req.MaxDurationSeconds != nil {
+			policy.MaxDuration = time.Duration(*req.MaxDurationSeconds) * time.Second
+		}
+		if req.ScheduledStart != nil {
+			policy.ScheduledStart = *req.ScheduledStart
+		}
+		if req.ScheduledEnd != nil {
+			policy.ScheduledEnd = *req.ScheduledEnd
+		}
+		if req.Lobby != nil {
+			policy.Lobby = *req.Lobby
+		}
+
+		if err := policy.Validate(); err != nil {
+			logger.Warn().
+				Err(err).
+				Str("roomId", roomId).
+				Str("remote_addr", r.RemoteAddr).
+				Msg("update room request has invalid lifecycle policy")
+			http.Error(w, "Invalid room policy: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Name != nil {
+			room.SetName(*req.Name)
+		}
+		room.UpdatePolicy(policy)
+		saveRoom(r.Context(), store, room, logger)
+
+		content, _ := json.Marshal(map[string]interface{}{
+			"room_id":   room.ID,
+			"room_name": room.GetName(),
+		})
+		room.Broadcast("", core.Message{
+			Type:    "room_updated",
+			Action:  "update",
+			Content: string(content),
+		}, logger)
+
+		logger.Info().
+			Str("roomId", roomId).
+			Str("remote_addr", r.RemoteAddr).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("http_status", http.StatusOK).
+			Msg("room update request succeeded")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newRoomResponse(room, rm))
+	}
+}
+
+func DeleteRoomHandler(rm *streaming.RoomManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := rm.GetLogger()
+		roomId := chi.URLParam(r, "roomId")
+
+		if _, ok := rm.GetRoom(roomId); !ok {
+			http.Error(w, "Room does not exist", http.StatusNotFound)
+			return
+		}
+
+		rm.DeleteRoom(roomId)
+
+		logger.Info().
+			Str("roomId", roomId).
+			Str("remote_addr", r.RemoteAddr).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("http_status", http.StatusNoContent).
+			Msg("room delete request succeeded")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
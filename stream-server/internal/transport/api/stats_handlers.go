@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"stream-server/internal/streaming"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func GetParticipantStatsHandler(rm *streaming.RoomManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomId := chi.URLParam(r, "roomId")
+		participantId := chi.URLParam(r, "participantId")
+
+		room, ok := rm.GetTenantRoom(tenantID(r), roomId)
+		if !ok {
+			http.Error(w, "Room does not exist", http.StatusNotFound)
+			return
+		}
+
+		stats, ok := room.GetParticipantStats(participantId)
+		if !ok {
+			http.Error(w, "Participant does not exist", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ParticipantStatsResponse{
+			ParticipantID:   stats.ParticipantID,
+			RoundTripTimeMs: stats.RoundTripTimeMs,
+			JitterInMs:      stats.JitterInMs,
+			JitterOutMs:     stats.JitterOutMs,
+			PacketLossIn:    stats.PacketLossIn,
+			PacketLossOut:   stats.PacketLossOut,
+			BitrateIn:       stats.BitrateIn,
+			BitrateOut:      stats.BitrateOut,
+			FramerateIn:     stats.FramerateIn,
+			CollectedAt:     formatOptionalTime(stats.CollectedAt),
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"stream-server/internal/webhook"
+)
+
+// ListWebhookDeliveriesHandler returns the caller's recent webhook deliveries.
+// A nil dispatcher means webhooks are disabled and the list is always empty.
+func ListWebhookDeliveriesHandler(webhooks *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responses := make([]WebhookDeliveryResponse, 0)
+		if webhooks != nil {
+			for _, d := range webhooks.Deliveries(tenantID(r)) {
+				responses = append(responses, WebhookDeliveryResponse{
+					ID:          d.ID,
+					Event:       d.Event,
+					RoomID:      d.RoomID,
+					URL:         d.URL,
+					Attempts:    d.Attempts,
+					StatusCode:  d.StatusCode,
+					Error:       d.Error,
+					Succeeded:   d.Succeeded,
+					CreatedAt:   d.CreatedAt.Format(timeLayout),
+					CompletedAt: formatOptionalTime(d.CompletedAt),
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ListWebhookDeliveriesResponse{
+			Deliveries: responses,
+			Count:      len(responses),
+		})
+	}
+}
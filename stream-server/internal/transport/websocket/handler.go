@@ -1,64 +1,140 @@
 package websocket
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"stream-server/internal/auth"
 	"stream-server/internal/core"
+	"stream-server/internal/metrics"
 	. "stream-server/internal/streaming"
+	"stream-server/internal/tracing"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-func HandleWebSocket(rm *RoomManager) http.HandlerFunc {
+func HandleWebSocket(rm *RoomManager, tokens *auth.TokenIssuer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		roomID := chi.URLParam(r, "roomId")
-		userID := r.URL.Query().Get("userId")
-		role := r.URL.Query().Get("role")
+		token := r.URL.Query().Get("token")
 
 		logger := rm.GetLogger()
 
-		if roomID == "" || userID == "" || role == "" {
+		if roomID == "" || token == "" {
 			logger.Warn().
 				Str("room_id", roomID).
-				Str("user_id", userID).
-				Str("role", role).
 				Str("remote_addr", r.RemoteAddr).
 				Msg("WebSocket connection attempt with missing parameters")
-			http.Error(w, "Missing roomID or userID", http.StatusBadRequest)
+			http.Error(w, "Missing roomID or token", http.StatusBadRequest)
+			return
+		}
+
+		claims, err := tokens.Verify(token)
+		if err != nil || claims.RoomID != roomID {
+			logger.Warn().
+				Err(err).
+				Str("room_id", roomID).
+				Str("token_room_id", claims.RoomID).
+				Str("remote_addr", r.RemoteAddr).
+				Msg("WebSocket connection attempt with invalid token")
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
+		userID := claims.UserID
+
 		room, ok := rm.GetRoom(roomID)
+		if !ok {
+			// Rooms owned by another node are joined through an edge copy.
+			room, err = rm.EdgeRoom(r.Context(), roomID)
+			if errors.Is(err, ErrRoomNotFound) {
+				logger.Warn().
+					Str("room_id", roomID).
+					Str("user_id", userID).
+					Msg("attempted to join non-existent room")
+				http.Error(w, "Room does not exist", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				logger.Error().
+					Err(err).
+					Str("room_id", roomID).
+					Str("user_id", userID).
+					Msg("failed to open edge room")
+				http.Error(w, "Room is unavailable on this node", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		// Tokens stay valid after a room closes, and its id can be reused by
+		// another tenant.
+		if claims.TenantID != room.TenantID {
+			logger.Warn().
+				Str("room_id", roomID).
+				Str("user_id", userID).
+				Str("token_tenant_id", claims.TenantID).
+				Str("tenant_id", room.TenantID).
+				Msg("WebSocket connection attempt with a token of another tenant")
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
 
-		if existing, exists := room.Participants[userID]; exists {
+		// The room's record of the user's role wins over the token's.
+		role, permissions := room.RoleOf(userID, claims.Role, claims.Permissions)
+
+		if err := room.ReplaceParticipant(userID, role, logger); err != nil {
 			logger.Warn().
 				Str("room_id", roomID).
 				Str("user_id", userID).
 				Str("role", role).
 				Str("remote_addr", r.RemoteAddr).
-				Msg("User already have joined the room")
-			room.RemoveParticipant(existing, logger)
+				Msg("WebSocket connection rejected, user is connected with another role")
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 
+		if err := room.CheckRoleCapacity(role); err != nil {
+			logger.Warn().
+				Str("room_id", roomID).
+				Str("user_id", userID).
+				Str("role", role).
+				Msg("WebSocket connection rejected, role capacity reached")
+			http.Error(w, "Room is full", http.StatusForbidden)
+			return
 		}
 
+		// Signaling spans continue the trace of the upgrade request for as long
+		// as the connection lasts, so the context must outlive the request.
+		ctx, span := tracing.Start(context.WithoutCancel(r.Context()), "websocket.Upgrade",
+			attribute.String("room_id", roomID),
+			attribute.String("user_id", userID),
+			attribute.String("role", role),
+		)
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
+			tracing.RecordError(span, err)
+			span.End()
 			logger.Error().
 				Str("room_id", roomID).
 				Str("user_id", userID).
 				Str("remote_addr", r.RemoteAddr).
 				Err(err).
 				Msg("failed to upgrade to WebSocket")
+			metrics.WebSocketErrors.WithLabelValues("upgrade").Inc()
 			http.Error(w, "Something Went Wrong", http.StatusInternalServerError)
 			return
 		}
 
+		span.End()
+
 		logger.Debug().
 			Str("room_id", roomID).
 			Str("user_id", userID).
@@ -66,33 +142,33 @@ func HandleWebSocket(rm *RoomManager) http.HandlerFunc {
 			Str("remote_addr", r.RemoteAddr).
 			Msg("WebSocket connection upgraded successfully")
 
-		if !ok {
-			logger.Warn().
-				Str("room_id", roomID).
-				Str("user_id", userID).
-				Msg("attempted to join non-existent room")
-			conn.Close()
-			http.Error(w, "Room does not exist", http.StatusBadRequest)
-			return
-		}
-
 		wsConnection := NewWSConnection(conn)
 
 		p := &Participant{
-			ID:       userID,
-			Conn:     wsConnection,
-			Role:     role,
-			Room:     room,
-			Status:   "active",
-			SendChan: make(chan core.Message, 256),
-			JoinedAt: time.Now(),
+			ID:          userID,
+			Conn:        wsConnection,
+			Role:        role,
+			Permissions: permissions,
+			Room:        room,
+			Status:      "active",
+			SendChan:    make(chan core.Message, 256),
+			JoinedAt:    time.Now(),
+		}
+
+		if room.RequiresAdmission(p) {
+			admitted, err := room.WaitInLobby(p, logger)
+			if !admitted {
+				logger.Info().Str("room_id", roomID).Str("user_id", userID).Err(err).Msg("participant not admitted from lobby")
+				p.Conn.Close()
+				return
+			}
 		}
 
 		logger.Info().Str("room_id", roomID).Str("user_id", userID).Str("role", role).Msg("attempting to add participant to room")
 
 		if err := room.AddParticipant(p, logger); err != nil {
 			logger.Error().Str("room_id", roomID).Str("user_id", userID).Err(err).Msg("failed to add participant to room")
-			wsConnection.Close()
+			p.Conn.Close()
 			return
 		}
 
@@ -115,7 +191,7 @@ func HandleWebSocket(rm *RoomManager) http.HandlerFunc {
 		go func() {
 			defer wg.Done()
 			defer logger.Debug().Str("room_id", roomID).Str("user_id", userID).Msg("read pump terminated")
-			p.ReadPump(room, rm, logger)
+			p.ReadPump(ctx, room, rm, logger)
 		}()
 
 		wg.Wait()
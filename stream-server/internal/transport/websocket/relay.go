@@ -0,0 +1,86 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"stream-server/internal/auth"
+	"stream-server/internal/core"
+	"stream-server/internal/directory"
+	"stream-server/internal/metrics"
+	. "stream-server/internal/streaming"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+// HandleRelay accepts the relay link of an edge node joining a room owned by
+// this node. Edge nodes authenticate with a relay token signed with the
+// cluster's shared token secret.
+func HandleRelay(rm *RoomManager, tokens *auth.TokenIssuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := chi.URLParam(r, "roomId")
+		logger := rm.GetLogger()
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			http.Error(w, "Missing relay token", http.StatusUnauthorized)
+			return
+		}
+		claims, err := tokens.Verify(token)
+		if err != nil || claims.Role != core.RoleRelay || claims.RoomID != roomID {
+			logger.Warn().
+				Err(err).
+				Str("room_id", roomID).
+				Str("remote_addr", r.RemoteAddr).
+				Msg("relay connection attempt with invalid token")
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		room, ok := rm.GetRoom(roomID)
+		if !ok || room.IsEdge() {
+			http.Error(w, "Room does not exist", http.StatusNotFound)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Str("room_id", roomID).
+				Str("peer_node", claims.UserID).
+				Msg("failed to upgrade relay connection")
+			metrics.WebSocketErrors.WithLabelValues("upgrade").Inc()
+			return
+		}
+
+		rm.ServeRelay(room, conn, claims.UserID)
+	}
+}
+
+// NewRelayDialer links this node's edge rooms to their owner as nodeID.
+func NewRelayDialer(tokens *auth.TokenIssuer, nodeID string) RelayDialer {
+	return func(ctx context.Context, owner directory.Entry) (RelayConn, error) {
+		permissions := core.Permissions{CanPublish: true, CanSubscribe: true}
+		token, _, err := tokens.Issue(owner.RoomID, owner.TenantID, nodeID, core.RoleRelay, permissions)
+		if err != nil {
+			return nil, err
+		}
+
+		base := strings.Replace(strings.TrimSuffix(owner.NodeURL, "/"), "http", "ws", 1)
+		relayURL := base + "/relay/rooms/" + url.PathEscape(owner.RoomID)
+		header := http.Header{"Authorization": {"Bearer " + token}}
+
+		conn, resp, err := websocket.DefaultDialer.DialContext(ctx, relayURL, header)
+		if err != nil {
+			if resp != nil {
+				return nil, fmt.Errorf("%w: %s", err, resp.Status)
+			}
+			return nil, err
+		}
+		return conn, nil
+	}
+}
@@ -1,11 +1,16 @@
 package websocket
 
 import (
+	"stream-server/internal/metrics"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// closeWait bounds how long Close waits to send the close frame.
+const closeWait = time.Second
+
 type WSConnection struct {
 	conn *websocket.Conn
 	mu   sync.RWMutex
@@ -19,12 +24,18 @@ func (w *WSConnection) Send(data []byte) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	error := w.conn.WriteMessage(websocket.TextMessage, data)
+	if error != nil {
+		metrics.WebSocketErrors.WithLabelValues("write").Inc()
+	}
 	return error
 }
 
+// Close sends a close frame, so the client sees a normal closure, and closes
+// the connection.
 func (w *WSConnection) Close() {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	_ = w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(closeWait))
 	_ = w.conn.Close()
 }
 
@@ -33,6 +44,9 @@ func (w *WSConnection) Read() ([]byte, error) {
 	_, msg, error := w.conn.ReadMessage()
 
 	if error != nil {
+		if websocket.IsUnexpectedCloseError(error, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			metrics.WebSocketErrors.WithLabelValues("read").Inc()
+		}
 		return nil, error
 	}
 	return msg, nil
@@ -0,0 +1,188 @@
+package turnserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/turn/v4"
+	"github.com/rs/zerolog"
+)
+
+type Config struct {
+	// Port is used for both the UDP and the TCP listener.
+	Port int
+	// PublicIP is the address clients reach the server on. It is advertised in
+	// the TURN URLs and as the relay address.
+	PublicIP string
+	Realm    string
+	// Secret signs the REST-style credentials; every node sharing it accepts
+	// the others' credentials.
+	Secret        []byte
+	CredentialTTL time.Duration
+	// RelayPortMin and RelayPortMax bound the ports of relay allocations. Both
+	// zero lets the OS pick.
+	RelayPortMin uint16
+	RelayPortMax uint16
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Port:          3478,
+		Realm:         "stream-server",
+		CredentialTTL: time.Hour,
+	}
+}
+
+// Credentials are TURN REST API credentials: the username carries its expiry
+// and the password is an HMAC of the username.
+type Credentials struct {
+	URLs       []string
+	Username   string
+	Credential string
+	ExpiresAt  time.Time
+}
+
+type Server struct {
+	server *turn.Server
+	config Config
+	logger *zerolog.Logger
+}
+
+func NewServer(logger *zerolog.Logger, config Config) (*Server, error) {
+	publicIP := net.ParseIP(config.PublicIP)
+	if publicIP == nil {
+		return nil, fmt.Errorf("TURN public IP %q is not an IP address", config.PublicIP)
+	}
+	if len(config.Secret) == 0 {
+		return nil, fmt.Errorf("TURN secret must not be empty")
+	}
+
+	addr := fmt.Sprintf("0.0.0.0:%d", config.Port)
+	udpListener, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for TURN on UDP %s: %w", addr, err)
+	}
+	tcpListener, err := net.Listen("tcp4", addr)
+	if err != nil {
+		udpListener.Close()
+		return nil, fmt.Errorf("failed to listen for TURN on TCP %s: %w", addr, err)
+	}
+
+	var relayGenerator turn.RelayAddressGenerator = &turn.RelayAddressGeneratorStatic{
+		RelayAddress: publicIP,
+		Address:      "0.0.0.0",
+	}
+	if config.RelayPortMin != 0 || config.RelayPortMax != 0 {
+		relayGenerator = &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: publicIP,
+			Address:      "0.0.0.0",
+			MinPort:      config.RelayPortMin,
+			MaxPort:      config.RelayPortMax,
+		}
+	}
+
+	s := &Server{
+		config: config,
+		logger: logger,
+	}
+
+	s.server, err = turn.NewServer(turn.ServerConfig{
+		Realm:       config.Realm,
+		AuthHandler: s.authenticate,
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn:            udpListener,
+				RelayAddressGenerator: relayGenerator,
+				PermissionHandler:     s.permit,
+			},
+		},
+		ListenerConfigs: []turn.ListenerConfig{
+			{
+				Listener:              tcpListener,
+				RelayAddressGenerator: relayGenerator,
+				PermissionHandler:     s.permit,
+			},
+		},
+	})
+	if err != nil {
+		udpListener.Close()
+		tcpListener.Close()
+		return nil, fmt.Errorf("failed to start TURN server: %w", err)
+	}
+
+	logger.Info().Int("port", config.Port).Str("public_ip", config.PublicIP).Msg("TURN server started")
+	return s, nil
+}
+
+// authenticate accepts unexpired "<expiry>:<user>" usernames whose password
+// is the HMAC issued by Credentials.
+func (s *Server) authenticate(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
+	expiry, _, _ := strings.Cut(username, ":")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		s.logger.Warn().Str("username", username).Str("remote_addr", srcAddr.String()).Msg("TURN request with malformed username")
+		return nil, false
+	}
+	if time.Now().Unix() > unix {
+		s.logger.Debug().Str("username", username).Str("remote_addr", srcAddr.String()).Msg("TURN request with expired credentials")
+		return nil, false
+	}
+	return turn.GenerateAuthKey(username, realm, s.password(username)), true
+}
+
+// permit refuses to relay to peers on internal networks, which would let any
+// joined client reach services such as pprof or Redis through the relay.
+func (s *Server) permit(clientAddr net.Addr, peerIP net.IP) bool {
+	if !isPublicPeer(peerIP) {
+		s.logger.Warn().Str("remote_addr", clientAddr.String()).Str("peer_ip", peerIP.String()).Msg("TURN permission to internal address refused")
+		return false
+	}
+	return true
+}
+
+func isPublicPeer(ip net.IP) bool {
+	return ip != nil &&
+		!ip.IsUnspecified() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast()
+}
+
+func (s *Server) password(username string) string {
+	mac := hmac.New(sha1.New, s.config.Secret)
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Credentials issues credentials for userID that expire after the configured
+// TTL.
+func (s *Server) Credentials(userID string) Credentials {
+	expiresAt := time.Now().Add(s.config.CredentialTTL)
+	username := strconv.FormatInt(expiresAt.Unix(), 10) + ":" + userID
+	return Credentials{
+		URLs:       s.URLs(),
+		Username:   username,
+		Credential: s.password(username),
+		ExpiresAt:  expiresAt,
+	}
+}
+
+func (s *Server) URLs() []string {
+	hostPort := net.JoinHostPort(s.config.PublicIP, strconv.Itoa(s.config.Port))
+	return []string{
+		"turn:" + hostPort + "?transport=udp",
+		"turn:" + hostPort + "?transport=tcp",
+	}
+}
+
+func (s *Server) Close() error {
+	return s.server.Close()
+}
@@ -0,0 +1,41 @@
+package turnserver
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublicPeer(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"127.0.0.1", false},
+		{"127.10.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"::ffff:192.168.1.1", false},
+		{"fd00::1", false},
+		{"fc12:3456::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"172.32.0.1", true},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicPeer(net.ParseIP(tt.ip)); got != tt.public {
+			t.Errorf("isPublicPeer(%s) = %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+	if isPublicPeer(nil) {
+		t.Error("isPublicPeer(nil) = true, want false")
+	}
+}
@@ -0,0 +1,416 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"stream-server/internal/streaming"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	SignatureHeader = "X-Stream-Signature"
+	EventHeader     = "X-Stream-Event"
+	DeliveryHeader  = "X-Stream-Delivery"
+)
+
+var errQueueFull = errors.New("webhook queue full, event dropped")
+
+type Config struct {
+	Endpoints      []Endpoint
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	// QueueSize is the number of undelivered events buffered per endpoint.
+	QueueSize int
+	// LogSize is the number of deliveries kept in the delivery log.
+	LogSize int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Timeout:        5 * time.Second,
+		QueueSize:      1024,
+		LogSize:        500,
+	}
+}
+
+// Endpoint receives the events of one tenant's rooms, signed with the
+// tenant's secret.
+type Endpoint struct {
+	TenantID string
+	URL      string
+	Secret   []byte
+}
+
+// Payload is the JSON body posted to webhook endpoints.
+type Payload struct {
+	ID              string `json:"id"`
+	Event           string `json:"event"`
+	RoomID          string `json:"room_id"`
+	TenantID        string `json:"tenant_id"`
+	Sequence        uint64 `json:"sequence"`
+	ParticipantID   string `json:"participant_id,omitempty"`
+	ParticipantName string `json:"participant_name,omitempty"`
+	Role            string `json:"role,omitempty"`
+	PreviousRole    string `json:"previous_role,omitempty"`
+	TrackID         string `json:"track_id,omitempty"`
+	Kind            string `json:"kind,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	CreatedAt       int64  `json:"created_at"`
+}
+
+// Delivery records the outcome of sending one payload to one endpoint.
+type Delivery struct {
+	ID          string
+	Event       string
+	RoomID      string
+	TenantID    string
+	URL         string
+	Attempts    int
+	StatusCode  int
+	Error       string
+	Succeeded   bool
+	CreatedAt   time.Time
+	CompletedAt time.Time
+}
+
+type endpoint struct {
+	Endpoint
+	queue chan Payload
+}
+
+type endpointKey struct {
+	tenantID, url, secret string
+}
+
+func (e Endpoint) key() endpointKey {
+	return endpointKey{e.TenantID, e.URL, string(e.Secret)}
+}
+
+// Dispatcher posts room events to the endpoints of the room's tenant. Each
+// endpoint has its own queue and worker, so events reach an endpoint in the
+// order they were produced and a slow endpoint does not hold up the others.
+type Dispatcher struct {
+	config     Config
+	client     *http.Client
+	endpoints  []*endpoint
+	logger     *zerolog.Logger
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	deliveries []Delivery
+	next       int
+	closed     bool
+	mu         sync.Mutex
+}
+
+func NewDispatcher(logger *zerolog.Logger, config Config) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	for _, e := range config.Endpoints {
+		d.endpoints = append(d.endpoints, d.startLocked(e))
+	}
+
+	return d
+}
+
+func (d *Dispatcher) startLocked(e Endpoint) *endpoint {
+	ep := &endpoint{
+		Endpoint: e,
+		queue:    make(chan Payload, d.config.QueueSize),
+	}
+	d.wg.Add(1)
+	go d.run(ep)
+	return ep
+}
+
+// SetEndpoints replaces the endpoints. Endpoints that are removed or whose
+// secret changed still deliver the events already queued for them.
+func (d *Dispatcher) SetEndpoints(endpoints []Endpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	current := make(map[endpointKey]*endpoint, len(d.endpoints))
+	for _, ep := range d.endpoints {
+		current[ep.key()] = ep
+	}
+
+	next := make([]*endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		if ep, ok := current[e.key()]; ok {
+			delete(current, e.key())
+			next = append(next, ep)
+			continue
+		}
+		next = append(next, d.startLocked(e))
+	}
+	for _, ep := range current {
+		close(ep.queue)
+	}
+	d.endpoints = next
+}
+
+// HandleEvent queues the event for every endpoint of the room's tenant. It is
+// meant to be subscribed to the room event bus and never blocks; events are
+// dropped and logged as failed deliveries when an endpoint's queue is full.
+func (d *Dispatcher) HandleEvent(event streaming.Event) {
+	payload := Payload{
+		ID:              newDeliveryID(),
+		Event:           string(event.Type),
+		RoomID:          event.RoomID,
+		TenantID:        event.TenantID,
+		Sequence:        event.Sequence,
+		ParticipantID:   event.ParticipantID,
+		ParticipantName: event.ParticipantName,
+		Role:            event.Role,
+		PreviousRole:    event.PreviousRole,
+		TrackID:         event.TrackID,
+		Kind:            event.Kind,
+		Reason:          event.Reason,
+		CreatedAt:       event.Timestamp.Unix(),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	for _, ep := range d.endpoints {
+		if ep.TenantID != payload.TenantID {
+			continue
+		}
+		select {
+		case ep.queue <- payload:
+		default:
+			d.logger.Warn().Str("url", ep.URL).Str("event", payload.Event).Str("room_id", payload.RoomID).Msg("webhook queue full, dropping event")
+			d.recordLocked(Delivery{
+				ID:          payload.ID,
+				Event:       payload.Event,
+				RoomID:      payload.RoomID,
+				TenantID:    payload.TenantID,
+				URL:         ep.URL,
+				Error:       errQueueFull.Error(),
+				CreatedAt:   time.Unix(payload.CreatedAt, 0),
+				CompletedAt: time.Now(),
+			})
+		}
+	}
+}
+
+// Stop stops accepting events and waits for queued events to be delivered
+// until ctx is done, after which pending deliveries are abandoned.
+func (d *Dispatcher) Stop(ctx context.Context) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	for _, ep := range d.endpoints {
+		close(ep.queue)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+}
+
+func (d *Dispatcher) run(ep *endpoint) {
+	defer d.wg.Done()
+	for payload := range ep.queue {
+		d.deliver(ep.Endpoint, payload)
+	}
+}
+
+func (d *Dispatcher) deliver(ep Endpoint, payload Payload) {
+	url := ep.URL
+	delivery := Delivery{
+		ID:        payload.ID,
+		Event:     payload.Event,
+		RoomID:    payload.RoomID,
+		TenantID:  payload.TenantID,
+		URL:       url,
+		CreatedAt: time.Unix(payload.CreatedAt, 0),
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		delivery.Error = err.Error()
+		delivery.CompletedAt = time.Now()
+		d.record(delivery)
+		return
+	}
+
+	backoff := d.config.InitialBackoff
+	for delivery.Attempts < d.config.MaxAttempts {
+		delivery.Attempts++
+
+		status, err := d.post(ep, payload, body)
+		delivery.StatusCode = status
+		if err == nil {
+			delivery.Succeeded = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+
+		d.logger.Warn().
+			Err(err).
+			Str("url", url).
+			Str("event", payload.Event).
+			Str("delivery_id", payload.ID).
+			Int("attempt", delivery.Attempts).
+			Msg("webhook delivery failed")
+
+		if !retryable(status) || delivery.Attempts >= d.config.MaxAttempts {
+			break
+		}
+
+		// Full jitter keeps retries from many rooms from lining up.
+		wait := time.Duration(mrand.Int63n(int64(backoff) + 1))
+		select {
+		case <-time.After(wait):
+		case <-d.ctx.Done():
+			delivery.Error = "dispatcher stopped before delivery"
+			delivery.CompletedAt = time.Now()
+			d.record(delivery)
+			return
+		}
+
+		backoff *= 2
+		if backoff > d.config.MaxBackoff {
+			backoff = d.config.MaxBackoff
+		}
+	}
+
+	delivery.CompletedAt = time.Now()
+	d.record(delivery)
+
+	if delivery.Succeeded {
+		d.logger.Debug().Str("url", url).Str("event", payload.Event).Str("delivery_id", payload.ID).Int("attempts", delivery.Attempts).Msg("webhook delivered")
+	}
+}
+
+// post sends one attempt and returns the response status, or 0 if no response
+// was received.
+func (d *Dispatcher) post(ep Endpoint, payload Payload, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, payload.Event)
+	req.Header.Set(DeliveryHeader, payload.ID)
+	req.Header.Set(SignatureHeader, "t="+timestamp+",v1="+Sign(ep.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func retryable(status int) bool {
+	return status == 0 ||
+		status == http.StatusRequestTimeout ||
+		status == http.StatusTooManyRequests ||
+		status >= 500
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.body". Receivers recompute it
+// from the t= value of the signature header and compare with v1=.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) record(delivery Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.recordLocked(delivery)
+}
+
+func (d *Dispatcher) recordLocked(delivery Delivery) {
+	if d.config.LogSize <= 0 {
+		return
+	}
+	if len(d.deliveries) < d.config.LogSize {
+		d.deliveries = append(d.deliveries, delivery)
+		return
+	}
+	d.deliveries[d.next] = delivery
+	d.next = (d.next + 1) % d.config.LogSize
+}
+
+// Deliveries returns the logged deliveries for tenantID, newest first.
+func (d *Dispatcher) Deliveries(tenantID string) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deliveries := make([]Delivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		delivery := d.deliveries[(d.next+i)%len(d.deliveries)]
+		if delivery.TenantID == tenantID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries
+}
+
+func newDeliveryID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
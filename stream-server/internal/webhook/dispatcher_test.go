@@ -0,0 +1,256 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"stream-server/internal/streaming"
+
+	"github.com/rs/zerolog"
+)
+
+// receiver is a webhook endpoint stand-in that answers with the queued
+// statuses in turn and 200 once they run out.
+type receiver struct {
+	server   *httptest.Server
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+	mu       sync.Mutex
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+	rc := &receiver{statuses: statuses}
+	rc.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rc.mu.Lock()
+		rc.requests = append(rc.requests, r)
+		rc.bodies = append(rc.bodies, body)
+		status := http.StatusOK
+		if len(rc.statuses) > 0 {
+			status = rc.statuses[0]
+			rc.statuses = rc.statuses[1:]
+		}
+		rc.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rc.server.Close)
+	return rc
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.requests)
+}
+
+func newTestDispatcher(t *testing.T, endpoints ...Endpoint) *Dispatcher {
+	t.Helper()
+	logger := zerolog.Nop()
+	config := DefaultConfig()
+	config.Endpoints = endpoints
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = 5 * time.Millisecond
+	d := NewDispatcher(&logger, config)
+	t.Cleanup(func() { d.Stop(context.Background()) })
+	return d
+}
+
+func event(tenantID string) streaming.Event {
+	return streaming.Event{
+		Type:          streaming.EventParticipantJoined,
+		RoomID:        "room-1",
+		TenantID:      tenantID,
+		ParticipantID: "alice",
+		Timestamp:     time.Now(),
+	}
+}
+
+// drain stops the dispatcher, which waits for queued deliveries.
+func drain(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	d.Stop(ctx)
+}
+
+func TestDeliverySigned(t *testing.T) {
+	rc := newReceiver(t)
+	secret := []byte("secret")
+	d := newTestDispatcher(t, Endpoint{TenantID: "acme", URL: rc.server.URL, Secret: secret})
+
+	d.HandleEvent(event("acme"))
+	drain(t, d)
+
+	if rc.count() != 1 {
+		t.Fatalf("receiver got %d requests, want 1", rc.count())
+	}
+	rc.mu.Lock()
+	req, body := rc.requests[0], rc.bodies[0]
+	rc.mu.Unlock()
+
+	var timestamp, signature string
+	for _, part := range strings.Split(req.Header.Get(SignatureHeader), ",") {
+		if value, ok := strings.CutPrefix(part, "t="); ok {
+			timestamp = value
+		} else if value, ok := strings.CutPrefix(part, "v1="); ok {
+			signature = value
+		}
+	}
+	if signature == "" || signature != Sign(secret, timestamp, body) {
+		t.Errorf("signature header %q does not match the body", req.Header.Get(SignatureHeader))
+	}
+	if got := req.Header.Get(EventHeader); got != string(streaming.EventParticipantJoined) {
+		t.Errorf("%s = %q", EventHeader, got)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if payload.TenantID != "acme" || payload.ParticipantID != "alice" || payload.ID != req.Header.Get(DeliveryHeader) {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	deliveries := d.Deliveries("acme")
+	if len(deliveries) != 1 || !deliveries[0].Succeeded || deliveries[0].Attempts != 1 {
+		t.Errorf("deliveries = %+v, want one successful attempt", deliveries)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	rc := newReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	d := newTestDispatcher(t, Endpoint{TenantID: "acme", URL: rc.server.URL, Secret: []byte("secret")})
+
+	d.HandleEvent(event("acme"))
+	drain(t, d)
+
+	deliveries := d.Deliveries("acme")
+	if len(deliveries) != 1 || !deliveries[0].Succeeded || deliveries[0].Attempts != 3 {
+		t.Fatalf("deliveries = %+v, want success on the third attempt", deliveries)
+	}
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+	t.Run("client error", func(t *testing.T) {
+		rc := newReceiver(t, http.StatusBadRequest)
+		d := newTestDispatcher(t, Endpoint{TenantID: "acme", URL: rc.server.URL, Secret: []byte("secret")})
+
+		d.HandleEvent(event("acme"))
+		drain(t, d)
+
+		deliveries := d.Deliveries("acme")
+		if len(deliveries) != 1 || deliveries[0].Succeeded || deliveries[0].Attempts != 1 || deliveries[0].StatusCode != http.StatusBadRequest {
+			t.Errorf("deliveries = %+v, want one failed attempt", deliveries)
+		}
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		statuses := make([]int, DefaultConfig().MaxAttempts)
+		for i := range statuses {
+			statuses[i] = http.StatusBadGateway
+		}
+		rc := newReceiver(t, statuses...)
+		d := newTestDispatcher(t, Endpoint{TenantID: "acme", URL: rc.server.URL, Secret: []byte("secret")})
+
+		d.HandleEvent(event("acme"))
+		drain(t, d)
+
+		deliveries := d.Deliveries("acme")
+		if len(deliveries) != 1 || deliveries[0].Succeeded || deliveries[0].Attempts != len(statuses) {
+			t.Errorf("deliveries = %+v, want %d failed attempts", deliveries, len(statuses))
+		}
+		if rc.count() != len(statuses) {
+			t.Errorf("receiver got %d requests, want %d", rc.count(), len(statuses))
+		}
+	})
+}
+
+func TestDeliveryDroppedWhenQueueFull(t *testing.T) {
+	received := make(chan struct{}, 4)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	t.Cleanup(server.Close)
+
+	logger := zerolog.Nop()
+	config := DefaultConfig()
+	config.Endpoints = []Endpoint{{TenantID: "acme", URL: server.URL, Secret: []byte("secret")}}
+	config.QueueSize = 1
+	d := NewDispatcher(&logger, config)
+
+	// The first event is taken by the worker and blocks it, the second fills
+	// the queue and the rest are dropped.
+	d.HandleEvent(event("acme"))
+	<-received
+	for range 3 {
+		d.HandleEvent(event("acme"))
+	}
+
+	dropped := d.Deliveries("acme")
+	if len(dropped) != 2 {
+		t.Fatalf("deliveries = %+v, want two dropped events", dropped)
+	}
+	for _, delivery := range dropped {
+		if delivery.Succeeded || delivery.Error != errQueueFull.Error() || delivery.Attempts != 0 {
+			t.Errorf("delivery = %+v, want a dropped event", delivery)
+		}
+	}
+
+	close(release)
+	drain(t, d)
+	if got := len(d.Deliveries("acme")); got != 4 {
+		t.Errorf("%d deliveries logged, want 4", got)
+	}
+}
+
+func TestDeliveryPerTenant(t *testing.T) {
+	acme := newReceiver(t)
+	globex := newReceiver(t)
+	d := newTestDispatcher(t,
+		Endpoint{TenantID: "acme", URL: acme.server.URL, Secret: []byte("acme")},
+		Endpoint{TenantID: "globex", URL: globex.server.URL, Secret: []byte("globex")},
+	)
+
+	d.HandleEvent(event("acme"))
+	d.HandleEvent(event("acme"))
+	d.HandleEvent(event("globex"))
+	d.HandleEvent(event("initech"))
+	drain(t, d)
+
+	if acme.count() != 2 || globex.count() != 1 {
+		t.Errorf("acme got %d events and globex %d, want 2 and 1", acme.count(), globex.count())
+	}
+	if len(d.Deliveries("acme")) != 2 || len(d.Deliveries("globex")) != 1 || len(d.Deliveries("initech")) != 0 {
+		t.Error("delivery log is not separated by tenant")
+	}
+}
+
+func TestSetEndpoints(t *testing.T) {
+	acme := newReceiver(t)
+	globex := newReceiver(t)
+	d := newTestDispatcher(t, Endpoint{TenantID: "acme", URL: acme.server.URL, Secret: []byte("acme")})
+
+	d.HandleEvent(event("acme"))
+	d.SetEndpoints([]Endpoint{{TenantID: "globex", URL: globex.server.URL, Secret: []byte("globex")}})
+	d.HandleEvent(event("acme"))
+	d.HandleEvent(event("globex"))
+	drain(t, d)
+
+	// The event queued before the reload still reaches the removed endpoint.
+	if acme.count() != 1 || globex.count() != 1 {
+		t.Errorf("acme got %d events and globex %d, want 1 and 1", acme.count(), globex.count())
+	}
+}